@@ -13,8 +13,13 @@ import (
 
 // API is the handler for the API
 type API struct {
-	client *docker.Client
-	logger *logrus.Logger
+	client   *docker.Client
+	logger   *logrus.Logger
+	auths    *docker.AuthConfigurations
+	policy   *Policy
+	events   *eventHub
+	history  *EventStore
+	webhooks *Webhooks
 }
 
 // NewApi creates a new API
@@ -43,7 +48,13 @@ func NewApi(endpoint string, logger *logrus.Logger) (*API, error) {
 		return nil, err
 	}
 
-	return &API{client, logger}, err
+	auths, err := docker.NewAuthConfigurationsFromDockerCfg()
+	if err != nil {
+		logger.Info("Registry credentials are not loaded: ", err)
+		auths = nil
+	}
+
+	return &API{client: client, logger: logger, auths: auths, events: newEventHub(client, logger)}, nil
 }
 
 // Router returns the router for the API
@@ -51,38 +62,85 @@ func (a *API) Router() func(r chi.Router) {
 	return func(r chi.Router) {
 		r.Use(a.headersMiddleware)
 
-		r.Get("/", a.GetDocker) // get the docker info
+		r.Get("/", a.GetDocker)                  // get the docker info
+		r.Get("/events", a.Events)               // stream docker events
+		r.Get("/events/history", a.EventHistory) // query recorded docker events
+
+		r.Route("/webhooks", func(r chi.Router) {
+			r.Get("/", a.ListWebhooks)   // get the list of webhooks
+			r.Post("/", a.CreateWebhook) // register a webhook
+
+			r.Route("/{id}", func(r chi.Router) {
+				r.Get("/", a.GetWebhook)                                       // get a webhook
+				r.Delete("/", a.DeleteWebhook)                                 // remove a webhook
+				r.Get("/deliveries", a.WebhookDeliveries)                      // get the delivery history of a webhook
+				r.Get("/deliveries/{delivery}", a.WebhookDelivery)             // get a delivery
+				r.Post("/deliveries/{delivery}/redeliver", a.RedeliverWebhook) // deliver an event again
+			})
+		})
 
 		r.Route("/containers", func(r chi.Router) {
 			r.Get("/", a.ListContainers)        // get the list of containers
 			r.Post("/", a.CreateContainer)      // create a container
+			r.Post("/run", a.RunContainer)      // run a container to completion
 			r.Post("/prune", a.PruneContainers) // prune containers
 
 			r.Route("/{id}", func(r chi.Router) {
-				r.Get("/", a.InspectContainerWithOptions) // inspect a container
-				r.Get("/logs", a.ContainerLogs)           // get the logs of a container
-				r.Get("/stop", a.StopContainer)           // stop a container
-				r.Get("/start", a.StartContainer)         // start a container
-				r.Get("/restart", a.RestartContainer)     // restart a container
-				r.Get("/pause", a.PauseContainer)         // pause a container
-				r.Get("/unpause", a.UnpauseContainer)     // unpause a container
-				r.Get("/kill", a.KillContainer)           // kill a container
-				r.Get("/export", a.ExportContainer)       // export a container
-				r.Get("/top", a.TopContainer)             // get the top of a container
-				r.Get("/wait", a.WaitContainer)           // wait for a container
-				r.Post("/rename", a.RenameContainer)      // rename a container
-				r.Post("/update", a.UpdateContainer)      // update a container
-				r.Post("/resize", a.ResizeContainerTTY)   // resize a container
-				r.Delete("/", a.RemoveContainer)          // remove a container
+				r.Get("/", a.InspectContainerWithOptions)  // inspect a container
+				r.Get("/logs", a.ContainerLogs)            // get the logs of a container
+				r.Get("/stop", a.StopContainer)            // stop a container
+				r.Get("/start", a.StartContainer)          // start a container
+				r.Get("/restart", a.RestartContainer)      // restart a container
+				r.Get("/pause", a.PauseContainer)          // pause a container
+				r.Get("/unpause", a.UnpauseContainer)      // unpause a container
+				r.Get("/kill", a.KillContainer)            // kill a container
+				r.Get("/export", a.ExportContainer)        // export a container
+				r.Get("/top", a.TopContainer)              // get the top of a container
+				r.Get("/stats", a.ContainerStats)          // get the resource usage of a container
+				r.Get("/changes", a.ContainerChanges)      // get the filesystem changes of a container
+				r.Get("/wait", a.WaitContainer)            // wait for a container
+				r.Post("/exec", a.CreateExec)              // create an exec session in a container
+				r.Get("/terminal", a.ExecTerminal)         // open an interactive shell over a websocket
+				r.Get("/attach", a.AttachTerminal)         // attach to a container over a websocket
+				r.Head("/archive", a.StatContainerPath)    // stat a path in a container
+				r.Get("/archive", a.DownloadFromContainer) // download a path from a container
+				r.Put("/archive", a.UploadToContainer)     // upload an archive or a file to a container
+				r.Post("/commit", a.CommitContainer)       // commit a container to a new image
+				r.Post("/rename", a.RenameContainer)       // rename a container
+				r.Post("/update", a.UpdateContainer)       // update a container
+				r.Post("/resize", a.ResizeContainerTTY)    // resize a container
+				r.Delete("/", a.RemoveContainer)           // remove a container
 			})
 		})
 
+		r.Route("/exec/{id}", func(r chi.Router) {
+			r.Get("/", a.InspectExec)          // inspect an exec session
+			r.Post("/start", a.StartExec)      // start an exec session
+			r.Post("/resize", a.ResizeExecTTY) // resize an exec session
+		})
+
 		r.Route("/networks", func(r chi.Router) {
-			r.Get("/", a.GetNetworks) // get the list of networks
+			r.Get("/", a.GetNetworks)         // get the list of networks
+			r.Post("/", a.CreateNetwork)      // create a network
+			r.Post("/prune", a.PruneNetworks) // prune networks
+
+			r.Route("/{id}", func(r chi.Router) {
+				r.Get("/", a.InspectNetwork)               // inspect a network
+				r.Post("/connect", a.ConnectNetwork)       // connect a container to a network
+				r.Post("/disconnect", a.DisconnectNetwork) // disconnect a container from a network
+				r.Delete("/", a.RemoveNetwork)             // remove a network
+			})
 		})
 
 		r.Route("/volumes", func(r chi.Router) {
-			r.Get("/", a.GetVolumes) // get the list of volumes
+			r.Get("/", a.GetVolumes)         // get the list of volumes
+			r.Post("/", a.CreateVolume)      // create a volume
+			r.Post("/prune", a.PruneVolumes) // prune volumes
+
+			r.Route("/{id}", func(r chi.Router) {
+				r.Get("/", a.InspectVolume)   // inspect a volume
+				r.Delete("/", a.RemoveVolume) // remove a volume
+			})
 		})
 
 		r.Route("/images", func(r chi.Router) {
@@ -90,18 +148,20 @@ func (a *API) Router() func(r chi.Router) {
 			r.Get("/search", a.SearchImages)     // search images
 			r.Get("/searchEx", a.SearchImagesEx) // search images
 			r.Get("/export", a.ExportImages)     // export images
+			r.Post("/pull", a.PullImage)         // pull an image
+			r.Post("/push", a.PushImage)         // push an image
+			r.Post("/build", a.BuildImage)       // build an image
+			r.Post("/load", a.LoadImage)         // load images from a tar
+			r.Post("/import", a.ImportImage)     // import an image from a filesystem tar
 			r.Post("/prune", a.PruneImages)      // prune images
 
 			r.Route("/{id}", func(r chi.Router) {
 				r.Get("/", a.InspectImage)                   // inspect an image
 				r.Get("/history", a.ImageHistory)            // get the history of an image
 				r.Get("/export", a.ExportImage)              // export an image
-				r.Get("/import", a.ImportImage)              // import an image
-				r.Get("/build", a.BuildImage)                // build an image
 				r.Post("/tag", a.TagImage)                   // tag an image
 				r.Post("/push", a.PushImage)                 // push an image
 				r.Post("/pull", a.PullImage)                 // pull an image
-				r.Post("/load", a.LoadImage)                 // load an image
 				r.Delete("/extended", a.RemoveImageExtended) // remove an image with options
 				r.Delete("/", a.RemoveImage)                 // remove an image
 			})
@@ -116,9 +176,16 @@ func (a *API) headersMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// Response is the body of a message or error response. Errors carry a
+// machine-readable Code and, when they concern a resource, its Kind and ID.
+// Rule names the violated policy rule of a policy_violation
 type Response struct {
 	Message string `json:",omitempty"`
 	Error   string `json:",omitempty"`
+	Code    string `json:",omitempty"`
+	Kind    string `json:",omitempty"`
+	ID      string `json:",omitempty"`
+	Rule    string `json:",omitempty"`
 }
 
 // write writes the response
@@ -135,5 +202,10 @@ func write(w http.ResponseWriter, statusCode int, data interface{}) {
 		}
 	}
 
+	if resp, ok := data.(Response); ok && resp.Error != "" && resp.Code == "" {
+		resp.Code = codeForStatus(statusCode)
+		data = resp
+	}
+
 	_ = json.NewEncoder(w).Encode(data)
 }
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// archiveWriter streams a tar archive to the client as a file download,
+// compressing it on the fly when asked to with ?compress=gzip or zstd. The headers
+// are written with the first byte, so errors that happen before that can
+// still be reported with write
+type archiveWriter struct {
+	w           http.ResponseWriter
+	filename    string
+	compression string
+	out         io.WriteCloser
+	started     bool
+}
+
+// newArchiveWriter creates an archive writer for a download named name.tar
+func newArchiveWriter(w http.ResponseWriter, r *http.Request, name string) (*archiveWriter, error) {
+	compression := r.URL.Query().Get("compress")
+	switch compression {
+	case "", "none", "gzip", "zstd":
+	default:
+		return nil, fmt.Errorf("invalid compress parameter: %q", compression)
+	}
+
+	return &archiveWriter{w: w, filename: archiveName(name) + ".tar", compression: compression}, nil
+}
+
+func (aw *archiveWriter) Write(p []byte) (int, error) {
+	if !aw.started {
+		aw.started = true
+
+		contentType := "application/x-tar"
+		filename := aw.filename
+
+		switch aw.compression {
+		case "gzip":
+			contentType = "application/gzip"
+			filename += ".gz"
+			aw.out = gzip.NewWriter(aw.w)
+		case "zstd":
+			zw, err := zstd.NewWriter(aw.w)
+			if err != nil {
+				return 0, err
+			}
+
+			contentType = "application/zstd"
+			filename += ".zst"
+			aw.out = zw
+		default:
+			aw.out = nopWriteCloser{aw.w}
+		}
+
+		aw.w.Header().Set("Content-Type", contentType)
+		aw.w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		aw.w.WriteHeader(http.StatusOK)
+	}
+
+	return aw.out.Write(p)
+}
+
+// Started reports whether anything was sent to the client
+func (aw *archiveWriter) Started() bool {
+	return aw.started
+}
+
+// Close flushes the compressor
+func (aw *archiveWriter) Close() error {
+	if aw.out == nil {
+		return nil
+	}
+
+	return aw.out.Close()
+}
+
+// abortArchive reports a failure of a download. Once the archive has started
+// the connection is aborted, so that the client sees a truncated transfer
+// instead of a seemingly complete but corrupt file
+func (a *API) abortArchive(aw *archiveWriter, err error) {
+	if aw.Started() {
+		a.logger.Error(err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// archiveName turns an image or container reference into a file name
+func archiveName(name string) string {
+	return strings.NewReplacer("/", "_", ":", "_", "@", "_").Replace(name)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// defaultRegistry is the key docker uses for Docker Hub credentials
+const defaultRegistry = "https://index.docker.io/v1/"
+
+// registryAuth resolves the credentials used to talk to a registry. Explicit
+// credentials from the request win, then the server-side entry named by ref,
+// then the server-side entry matching the registry of the image
+func (a *API) registryAuth(auth *docker.AuthConfiguration, ref, image string) (docker.AuthConfiguration, error) {
+	if auth != nil {
+		return *auth, nil
+	}
+
+	var configs map[string]docker.AuthConfiguration
+	if a.auths != nil {
+		configs = a.auths.Configs
+	}
+
+	if ref != "" {
+		c, ok := configs[ref]
+		if !ok {
+			return docker.AuthConfiguration{}, fmt.Errorf("no credentials named %q", ref)
+		}
+
+		return c, nil
+	}
+
+	return configs[imageRegistry(image)], nil
+}
+
+// imageRegistry returns the registry host of an image reference, or the
+// Docker Hub key when the reference has no registry part
+func imageRegistry(image string) string {
+	host, _, ok := strings.Cut(image, "/")
+	if !ok || (!strings.ContainsAny(host, ".:") && host != "localhost") {
+		return defaultRegistry
+	}
+
+	return host
+}
+
+// splitImageRef splits an image reference into repository and tag. Digest
+// references are returned whole, the tag defaults to "latest"
+func splitImageRef(image string) (repository, tag string) {
+	if strings.Contains(image, "@") {
+		return image, ""
+	}
+
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[:i], image[i+1:]
+	}
+
+	return image, "latest"
+}
@@ -1,35 +1,160 @@
 package api
 
 import (
-	"bytes"
+	"cmp"
 	"context"
 	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	docker "github.com/fsouza/go-dockerclient"
 	"github.com/go-chi/chi/v5"
 )
 
-// ListContainers returns the list of containers
+// ListContainers returns the list of containers. The status, label, name,
+// ancestor, network, id, health, before and since parameters map to docker
+// filters; all=false lists running containers only. The result can be sorted
+// by created, name or size and paginated with limit and offset
 func (a *API) ListContainers(w http.ResponseWriter, r *http.Request) {
+	all, err := queryBool(r, "all", true)
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	field, desc, err := querySort(r, "created", "name", "size")
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
 	containers, err := a.client.ListContainers(docker.ListContainersOptions{
-		All:     true,
+		All:     all,
+		Size:    field == "size",
+		Filters: queryFilters(r, "status", "label", "name", "ancestor", "network", "id", "health", "before", "since"),
 		Context: ctx,
 	})
 	if err != nil {
-		write(w, http.StatusInternalServerError, Response{Error: err.Error()})
+		writeError(w, err, "", "")
+		return
+	}
+
+	if field != "" {
+		slices.SortStableFunc(containers, func(x, y docker.APIContainers) int {
+			var c int
+			switch field {
+			case "created":
+				c = cmp.Compare(x.Created, y.Created)
+			case "name":
+				c = cmp.Compare(containerName(x), containerName(y))
+			case "size":
+				c = cmp.Compare(x.SizeRw, y.SizeRw)
+			}
+
+			if desc {
+				return -c
+			}
+
+			return c
+		})
+	}
+
+	containers, err = paginate(w, r, containers)
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
 		return
 	}
 
 	write(w, http.StatusOK, containers)
 }
 
-// CreateContainer runs a container
+// containerName returns the primary name of a container without the leading slash
+func containerName(c docker.APIContainers) string {
+	if len(c.Names) == 0 {
+		return ""
+	}
+
+	return strings.TrimPrefix(c.Names[0], "/")
+}
+
+// CreateResult is the outcome of a create
+type CreateResult struct {
+	*docker.Container
+	Started bool
+	Pull    *PullResult `json:",omitempty"`
+}
+
+// prepareCreate validates a container creation body against the policy and
+// pulls its image as the pull parameter asks, reporting failures to w. The
+// pull result is nil when nothing was pulled
+func (a *API) prepareCreate(w http.ResponseWriter, r *http.Request, c *docker.CreateContainerOptions) (*PullResult, bool) {
+	policy := r.URL.Query().Get("pull")
+	switch policy {
+	case "":
+		policy = "missing"
+	case "always", "missing", "never":
+	default:
+		write(w, http.StatusBadRequest, Response{Error: "invalid pull parameter: " + strconv.Quote(policy)})
+		return nil, false
+	}
+
+	if c.Config == nil || c.Config.Image == "" {
+		write(w, http.StatusBadRequest, Response{Error: "Config.Image is required"})
+		return nil, false
+	}
+
+	if err := a.policy.AdmitCreate(c, a.client); err != nil {
+		writeError(w, err, kindContainer, c.Name)
+		return nil, false
+	}
+
+	pull := policy == "always"
+	if policy == "missing" {
+		_, err := a.client.InspectImage(c.Config.Image)
+		if err != nil && !errors.Is(err, docker.ErrNoSuchImage) {
+			writeError(w, err, kindImage, c.Config.Image)
+			return nil, false
+		}
+
+		pull = err != nil
+	}
+
+	if !pull {
+		return nil, true
+	}
+
+	auth, err := a.registryAuth(nil, r.URL.Query().Get("authRef"), c.Config.Image)
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return nil, false
+	}
+
+	repository, tag := splitImageRef(c.Config.Image)
+
+	pulled, err := a.pullImage(r.Context(), repository, tag, c.Platform, auth, func(ProgressMessage) error {
+		return nil
+	})
+	if err != nil {
+		writeError(w, err, kindImage, c.Config.Image)
+		return nil, false
+	}
+
+	return &pulled, true
+}
+
+// CreateContainer creates a container and starts it unless start=false. The
+// pull parameter decides when the image is pulled first: always, missing
+// (the default) or never; authRef names server-side registry credentials.
+// A container that fails to start is removed again
 func (a *API) CreateContainer(w http.ResponseWriter, r *http.Request) {
 	var c docker.CreateContainerOptions
 
@@ -38,28 +163,59 @@ func (a *API) CreateContainer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	start, err := queryBool(r, "start", true)
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	pulled, ok := a.prepareCreate(w, r, &c)
+	if !ok {
+		return
+	}
+
+	result := CreateResult{Pull: pulled}
+
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
 	c.Context = ctx
 
-	create, err := a.client.CreateContainer(c)
+	result.Container, err = a.client.CreateContainer(c)
 	if err != nil {
-		if errors.Is(err, docker.ErrContainerAlreadyExists) {
-			write(w, http.StatusConflict, Response{Error: err.Error()})
+		if errors.Is(err, docker.ErrNoSuchImage) {
+			writeError(w, err, kindImage, c.Config.Image)
 			return
 		}
 
-		write(w, http.StatusInternalServerError, Response{Error: err.Error()})
+		writeError(w, err, kindContainer, c.Name)
 		return
 	}
 
-	if err = a.client.StartContainer(create.ID, nil); err != nil {
-		write(w, http.StatusInternalServerError, Response{Error: err.Error()})
-		return
+	if start {
+		if err = a.client.StartContainer(result.ID, nil); err != nil {
+			// do not leave a container behind that the caller never learns about;
+			// should the removal fail too the response still carries its ID
+			status, resp := errorResponse(err, kindContainer, result.ID)
+			if rerr := a.client.RemoveContainer(docker.RemoveContainerOptions{
+				ID:      result.ID,
+				Force:   true,
+				Context: r.Context(),
+			}); rerr != nil {
+				a.logger.Error(rerr)
+				resp.Message = "Container " + result.ID + " was created but not started"
+			} else {
+				resp.Message = "Container " + result.ID + " was created but not started and has been removed"
+			}
+
+			write(w, status, resp)
+			return
+		}
+
+		result.Started = true
 	}
 
-	write(w, http.StatusOK, create)
+	write(w, http.StatusOK, result)
 }
 
 // InspectContainerWithOptions inspects a container
@@ -74,12 +230,7 @@ func (a *API) InspectContainerWithOptions(w http.ResponseWriter, r *http.Request
 		Context: ctx,
 	})
 	if err != nil {
-		if err.Error() == (&docker.NoSuchContainer{ID: id}).Error() {
-			write(w, http.StatusNotFound, Response{Error: err.Error()})
-			return
-		}
-
-		write(w, http.StatusInternalServerError, Response{Error: err.Error()})
+		writeError(w, err, kindContainer, id)
 		return
 	}
 
@@ -99,12 +250,7 @@ func (a *API) RemoveContainer(w http.ResponseWriter, r *http.Request) {
 		Force:         false,
 		Context:       ctx,
 	}); err != nil {
-		if err.Error() == (&docker.NoSuchContainer{ID: id}).Error() {
-			write(w, http.StatusNotFound, Response{Error: err.Error()})
-			return
-		}
-
-		write(w, http.StatusInternalServerError, Response{Error: err.Error()})
+		writeError(w, err, kindContainer, id)
 		return
 	}
 
@@ -116,149 +262,336 @@ func (a *API) StartContainer(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 
 	if err := a.client.StartContainer(id, nil); err != nil {
-		if err.Error() == (&docker.NoSuchContainer{ID: id}).Error() {
-			write(w, http.StatusNotFound, Response{Error: err.Error()})
-			return
-		}
-
-		if err.Error() == (&docker.ContainerAlreadyRunning{ID: id}).Error() {
-			write(w, http.StatusConflict, Response{Error: err.Error()})
-			return
-		}
-
-		write(w, http.StatusInternalServerError, Response{Error: err.Error()})
+		writeError(w, err, kindContainer, id)
 		return
 	}
 
 	write(w, http.StatusOK, Response{Message: "Container started"})
 }
 
-// StopContainer stops a container
+// StopContainer stops a container. The timeout (seconds) and signal
+// parameters default to the StopTimeout and StopSignal of the container
 func (a *API) StopContainer(w http.ResponseWriter, r *http.Request) {
+	a.stopContainer(w, r, "stop", "Container stopped")
+}
+
+// LogLine is a single line of container output
+type LogLine struct {
+	Stream    string
+	Timestamp string `json:",omitempty"`
+	Line      string
+}
+
+// logsTimeout bounds reading the logs of a container without follow
+const logsTimeout = 5 * time.Minute
+
+// errLogsUntil stops reading logs once a line past the requested until time is seen
+var errLogsUntil = errors.New("logs until reached")
+
+// ContainerLogs returns the logs of a container. With follow=true the logs are
+// streamed as SSE or NDJSON until the client disconnects or until passes
+func (a *API) ContainerLogs(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 
-	if err := a.client.StopContainer(id, 0); err != nil {
-		if err.Error() == (&docker.NoSuchContainer{ID: id}).Error() {
-			write(w, http.StatusNotFound, Response{Error: err.Error()})
-			return
-		}
+	follow, err := queryBool(r, "follow", false)
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
 
-		if err.Error() == (&docker.ContainerNotRunning{ID: id}).Error() {
-			write(w, http.StatusConflict, Response{Error: err.Error()})
-			return
-		}
+	stdout, err := queryBool(r, "stdout", true)
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
 
-		write(w, http.StatusInternalServerError, Response{Error: err.Error()})
+	stderr, err := queryBool(r, "stderr", true)
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
 		return
 	}
 
-	write(w, http.StatusOK, Response{Message: "Container stopped"})
-}
+	timestamps, err := queryBool(r, "timestamps", false)
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
 
-// ContainerLogs returns the logs of a container
-func (a *API) ContainerLogs(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
+	since, err := queryTime(r, "since")
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	until, err := queryTime(r, "until")
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	tail := r.URL.Query().Get("tail")
+	if tail != "" && tail != "all" {
+		if n, err := strconv.Atoi(tail); err != nil || n < 0 {
+			write(w, http.StatusBadRequest, Response{Error: "invalid tail parameter: " + strconv.Quote(tail)})
+			return
+		}
+	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	var buf bytes.Buffer
-	err := a.client.Logs(docker.LogsOptions{
-		Context:      ctx,
-		Container:    id,
-		Stdout:       true,
-		Stderr:       true,
-		OutputStream: &buf,
-		ErrorStream:  &buf,
-		Timestamps:   true,
+	c, err := a.client.InspectContainerWithOptions(docker.InspectContainerOptions{
+		ID:      id,
+		Context: ctx,
 	})
 	if err != nil {
-		if err.Error() == (&docker.NoSuchContainer{ID: id}).Error() {
-			write(w, http.StatusNotFound, Response{Error: err.Error()})
+		writeError(w, err, kindContainer, id)
+		return
+	}
+
+	// following logs that already ended at until would wait for a line past it
+	live := follow && (until.IsZero() || until.After(time.Now()))
+
+	var logs []LogLine
+	stream := newEventStream(w, r)
+	defer stream.Close()
+
+	if follow {
+		ctx, cancel = context.WithCancel(r.Context())
+		defer cancel()
+
+		// a quiet container sends nothing past until, end the stream at that time
+		if live && !until.IsZero() {
+			timer := time.AfterFunc(time.Until(until), cancel)
+			defer timer.Stop()
+		}
+
+		// a quiet container sends nothing at all, answer right away
+		if err = stream.Open(); err != nil {
 			return
 		}
+	} else {
+		// a long tail takes a while to read and buffer
+		ctx, cancel = context.WithTimeout(r.Context(), logsTimeout)
+		defer cancel()
+	}
 
-		write(w, http.StatusInternalServerError, Response{Error: err.Error()})
-		return
+	// timestamps are always requested so that until can be applied
+	emit := func(name string) func(line []byte) error {
+		return func(line []byte) error {
+			entry := LogLine{Stream: name, Line: string(line)}
+
+			if ts, rest, ok := strings.Cut(entry.Line, " "); ok {
+				if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+					if !until.IsZero() && t.After(until) {
+						return errLogsUntil
+					}
+
+					entry.Line = rest
+					if timestamps {
+						entry.Timestamp = ts
+					}
+				}
+			}
+
+			if !follow {
+				logs = append(logs, entry)
+				return nil
+			}
+
+			return stream.Send(name, entry)
+		}
 	}
 
-	var logs []string
-	for _, line := range bytes.Split(buf.Bytes(), []byte("\n")) {
-		if len(line) > 0 {
-			logs = append(logs, string(line))
+	outWriter := &lineWriter{fn: emit("stdout")}
+	errWriter := &lineWriter{fn: emit("stderr")}
+
+	opts := docker.LogsOptions{
+		Context:      ctx,
+		Container:    id,
+		Tail:         tail,
+		Follow:       live,
+		Stdout:       stdout,
+		Stderr:       stderr,
+		OutputStream: outWriter,
+		ErrorStream:  errWriter,
+		Timestamps:   true,
+		RawTerminal:  c.Config != nil && c.Config.Tty,
+	}
+	if !since.IsZero() {
+		opts.Since = since.Unix()
+	}
+
+	err = a.client.Logs(opts)
+	if err == nil {
+		if err = outWriter.Flush(); err == nil {
+			err = errWriter.Flush()
 		}
 	}
+	switch {
+	case err == nil, errors.Is(err, errLogsUntil):
+	case follow && r.Context().Err() != nil:
+		return
+	case follow && ctx.Err() != nil:
+		// ended by the until timer
+	default:
+		stream.Error(err, kindContainer, id)
+		return
+	}
+
+	if follow {
+		return
+	}
 
 	write(w, http.StatusOK, logs)
 }
 
-// RestartContainer restarts a container
+// RestartContainer restarts a container. The timeout (seconds) and signal
+// parameters default to the StopTimeout and StopSignal of the container
 func (a *API) RestartContainer(w http.ResponseWriter, r *http.Request) {
+	a.stopContainer(w, r, "restart", "Container restarted")
+}
+
+// stopContainer stops or restarts a container depending on action
+func (a *API) stopContainer(w http.ResponseWriter, r *http.Request, action, message string) {
 	id := chi.URLParam(r, "id")
 
-	if err := a.client.RestartContainer(id, 0); err != nil {
-		if err.Error() == (&docker.NoSuchContainer{ID: id}).Error() {
-			write(w, http.StatusNotFound, Response{Error: err.Error()})
-			return
+	timeout, err := queryInt(r, "timeout", -1)
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	signal := r.URL.Query().Get("signal")
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	c, err := a.client.InspectContainerWithOptions(docker.InspectContainerOptions{
+		ID:      id,
+		Context: ctx,
+	})
+	if err != nil {
+		writeError(w, err, kindContainer, id)
+		return
+	}
+
+	if c.Config != nil {
+		if timeout < 0 && c.Config.StopTimeout > 0 {
+			timeout = c.Config.StopTimeout
+		}
+
+		if signal == "" {
+			signal = c.Config.StopSignal
 		}
+	}
+
+	if timeout < 0 {
+		timeout = 10
+	}
 
-		write(w, http.StatusInternalServerError, Response{Error: err.Error()})
+	params := url.Values{"t": {strconv.Itoa(timeout)}}
+	if signal != "" {
+		params.Set("signal", signal)
+	}
+
+	// the daemon only answers once the grace period is over
+	ctx, cancel = context.WithTimeout(r.Context(), time.Duration(timeout)*time.Second+30*time.Second)
+	defer cancel()
+
+	if err = a.containerAction(ctx, id, action, params); err != nil {
+		writeError(w, err, kindContainer, id)
 		return
 	}
 
-	write(w, http.StatusOK, Response{Message: "Container restarted"})
+	write(w, http.StatusOK, Response{Message: message})
 }
 
-// ExportContainer exports a container
+// containerAction posts a stop, restart or kill to the daemon. go-dockerclient
+// can not pass a signal to stop and restart, so the daemon is called directly
+func (a *API) containerAction(ctx context.Context, id, action string, params url.Values) error {
+	resp, err := a.daemonRequest(ctx, http.MethodPost, "/containers/"+id+"/"+action, params, nil)
+	if err != nil {
+		var e *docker.Error
+		if errors.As(err, &e) {
+			switch e.Status {
+			case http.StatusNotFound:
+				return &docker.NoSuchContainer{ID: id}
+			case http.StatusConflict:
+				// other conflicts, e.g. a paused container or one being
+				// removed, are reported as they are
+				if strings.Contains(e.Message, "is not running") {
+					return &docker.ContainerNotRunning{ID: id}
+				}
+			}
+		}
+
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return &docker.ContainerNotRunning{ID: id}
+	}
+
+	return nil
+}
+
+// ExportContainer streams the filesystem of a container as a tar
 func (a *API) ExportContainer(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 
-	ctx, cancel := context.WithTimeout(r.Context(), 50*time.Second)
+	aw, err := newArchiveWriter(w, r, id)
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
 	defer cancel()
 
-	var out = &bytes.Buffer{}
-	err := a.client.ExportContainer(docker.ExportContainerOptions{
-		ID:           id,
-		Context:      ctx,
-		OutputStream: out,
-	})
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(a.client.ExportContainer(docker.ExportContainerOptions{
+			ID:           id,
+			Context:      ctx,
+			OutputStream: pw,
+		}))
+	}()
+
+	// a failed write to the client closes the pipe, which stops the export
+	_, err = io.Copy(aw, pr)
+	_ = pr.CloseWithError(err)
+	if err == nil {
+		err = aw.Close()
+	}
 	if err != nil {
-		if err.Error() == (&docker.NoSuchContainer{ID: id}).Error() {
-			write(w, http.StatusNotFound, Response{Error: err.Error()})
+		if r.Context().Err() != nil {
 			return
 		}
 
-		write(w, http.StatusInternalServerError, Response{Error: err.Error()})
-		return
-	}
-
-	w.Header().Set("Content-Disposition", "attachment; filename="+id+".tar")
-	w.Header().Set("Content-Type", "application/octet-stream")
+		a.abortArchive(aw, err)
 
-	if _, err := w.Write(out.Bytes()); err != nil {
-		write(w, http.StatusInternalServerError, Response{Error: err.Error()})
+		writeError(w, err, kindContainer, id)
 		return
 	}
-
-	write(w, http.StatusOK, Response{Message: "Container exported"})
 }
 
-// KillContainer kills a container
+// KillContainer sends a signal to a container, SIGKILL unless the signal
+// parameter names another one
 func (a *API) KillContainer(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 
-	if err := a.client.KillContainer(docker.KillContainerOptions{ID: id}); err != nil {
-		if err.Error() == (&docker.NoSuchContainer{ID: id}).Error() {
-			write(w, http.StatusNotFound, Response{Error: err.Error()})
-			return
-		}
+	signal := r.URL.Query().Get("signal")
+	if signal == "" {
+		signal = "SIGKILL"
+	}
 
-		if err.Error() == (&docker.ContainerNotRunning{ID: id}).Error() {
-			write(w, http.StatusConflict, Response{Error: err.Error()})
-			return
-		}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
 
-		write(w, http.StatusInternalServerError, Response{Error: err.Error()})
+	if err := a.containerAction(ctx, id, "kill", url.Values{"signal": {signal}}); err != nil {
+		writeError(w, err, kindContainer, id)
 		return
 	}
 
@@ -270,12 +603,7 @@ func (a *API) PauseContainer(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 
 	if err := a.client.PauseContainer(id); err != nil {
-		if err.Error() == (&docker.NoSuchContainer{ID: id}).Error() {
-			write(w, http.StatusNotFound, Response{Error: err.Error()})
-			return
-		}
-
-		write(w, http.StatusInternalServerError, Response{Error: err.Error()})
+		writeError(w, err, kindContainer, id)
 		return
 	}
 
@@ -291,7 +619,7 @@ func (a *API) PruneContainers(w http.ResponseWriter, r *http.Request) {
 		Context: ctx,
 	})
 	if err != nil {
-		write(w, http.StatusInternalServerError, Response{Error: err.Error()})
+		writeError(w, err, "", "")
 		return
 	}
 
@@ -303,12 +631,7 @@ func (a *API) UnpauseContainer(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 
 	if err := a.client.UnpauseContainer(id); err != nil {
-		if err.Error() == (&docker.NoSuchContainer{ID: id}).Error() {
-			write(w, http.StatusNotFound, Response{Error: err.Error()})
-			return
-		}
-
-		write(w, http.StatusInternalServerError, Response{Error: err.Error()})
+		writeError(w, err, kindContainer, id)
 		return
 	}
 
@@ -326,18 +649,18 @@ func (a *API) UpdateContainer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := a.policy.AdmitUpdate(&c); err != nil {
+		writeError(w, err, kindContainer, id)
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
 	c.Context = ctx
 
 	if err := a.client.UpdateContainer(id, c); err != nil {
-		if err.Error() == (&docker.NoSuchContainer{ID: id}).Error() {
-			write(w, http.StatusNotFound, Response{Error: err.Error()})
-			return
-		}
-
-		write(w, http.StatusInternalServerError, Response{Error: err.Error()})
+		writeError(w, err, kindContainer, id)
 		return
 	}
 
@@ -356,12 +679,7 @@ func (a *API) ResizeContainerTTY(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := a.client.ResizeContainerTTY(id, c.Height, c.Width); err != nil {
-		if err.Error() == (&docker.NoSuchContainer{ID: id}).Error() {
-			write(w, http.StatusNotFound, Response{Error: err.Error()})
-			return
-		}
-
-		write(w, http.StatusInternalServerError, Response{Error: err.Error()})
+		writeError(w, err, kindContainer, id)
 		return
 	}
 
@@ -379,18 +697,19 @@ func (a *API) RenameContainer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if c.Name == "" {
+		write(w, http.StatusBadRequest, Response{Error: "Name is required"})
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
+	c.ID = id
 	c.Context = ctx
 
 	if err := a.client.RenameContainer(c); err != nil {
-		if err.Error() == (&docker.NoSuchContainer{ID: id}).Error() {
-			write(w, http.StatusNotFound, Response{Error: err.Error()})
-			return
-		}
-
-		write(w, http.StatusInternalServerError, Response{Error: err.Error()})
+		writeError(w, err, kindContainer, id)
 		return
 	}
 
@@ -403,32 +722,295 @@ func (a *API) TopContainer(w http.ResponseWriter, r *http.Request) {
 
 	top, err := a.client.TopContainer(id, "")
 	if err != nil {
-		if err.Error() == (&docker.NoSuchContainer{ID: id}).Error() {
-			write(w, http.StatusNotFound, Response{Error: err.Error()})
-			return
-		}
-
-		write(w, http.StatusInternalServerError, Response{Error: err.Error()})
+		writeError(w, err, kindContainer, id)
 		return
 	}
 
 	write(w, http.StatusOK, top)
 }
 
-// WaitContainer waits for a container
+// maxWaitTimeout bounds how long a wait request may poll
+const maxWaitTimeout = 10 * time.Minute
+
+// WaitTimeout is returned when a wait times out
+type WaitTimeout struct {
+	Response
+	State docker.State
+}
+
+// WaitContainer waits for a container to reach condition (not-running,
+// next-exit or removed). The wait is bounded by the timeout parameter, one
+// minute by default and ten at most; when it runs out the current state of
+// the container is returned with 408. On success the exit code is returned
 func (a *API) WaitContainer(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 
-	status, err := a.client.WaitContainer(id)
+	condition := r.URL.Query().Get("condition")
+	switch condition {
+	case "", "not-running", "next-exit", "removed":
+	default:
+		write(w, http.StatusBadRequest, Response{Error: "invalid condition parameter: " + strconv.Quote(condition)})
+		return
+	}
+
+	timeout, err := queryDuration(r, "timeout", time.Minute)
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	if timeout <= 0 {
+		write(w, http.StatusBadRequest, Response{Error: "timeout must be positive"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), min(timeout, maxWaitTimeout))
+	defer cancel()
+
+	var status int
+	if condition == "" || condition == "not-running" {
+		status, err = a.client.WaitContainerWithContext(id, ctx)
+	} else {
+		status, err = a.waitContainerCondition(ctx, id, condition)
+	}
 	if err != nil {
-		if err.Error() == (&docker.NoSuchContainer{ID: id}).Error() {
-			write(w, http.StatusNotFound, Response{Error: err.Error()})
+		if r.Context().Err() != nil {
+			return
+		}
+
+		if ctx.Err() == context.DeadlineExceeded {
+			ctx, cancel = context.WithTimeout(r.Context(), 5*time.Second)
+			defer cancel()
+
+			c, err := a.client.InspectContainerWithOptions(docker.InspectContainerOptions{
+				ID:      id,
+				Context: ctx,
+			})
+			resp := Response{Error: "Timed out waiting for container " + id, Code: codeTimeout, Kind: kindContainer, ID: id}
+			if err != nil {
+				write(w, http.StatusRequestTimeout, resp)
+				return
+			}
+
+			write(w, http.StatusRequestTimeout, WaitTimeout{Response: resp, State: c.State})
 			return
 		}
 
-		write(w, http.StatusInternalServerError, Response{Error: err.Error()})
+		writeError(w, err, kindContainer, id)
 		return
 	}
 
 	write(w, http.StatusOK, status)
 }
+
+// waitContainerCondition waits for a container to reach condition.
+// go-dockerclient has no wait condition, so the daemon is called directly
+func (a *API) waitContainerCondition(ctx context.Context, id, condition string) (int, error) {
+	resp, err := a.daemonRequest(ctx, http.MethodPost, "/containers/"+id+"/wait", url.Values{"condition": {condition}}, nil)
+	if err != nil {
+		var e *docker.Error
+		if errors.As(err, &e) && e.Status == http.StatusNotFound {
+			return 0, &docker.NoSuchContainer{ID: id}
+		}
+
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		StatusCode int
+		Error      *struct{ Message string }
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+
+		return 0, err
+	}
+
+	if result.Error != nil && result.Error.Message != "" {
+		return result.StatusCode, errors.New(result.Error.Message)
+	}
+
+	return result.StatusCode, nil
+}
+
+// ContainerChange is a filesystem change of a container relative to its image
+type ContainerChange struct {
+	Path string
+	Kind string // added, modified or deleted
+}
+
+// ChangesSummary counts container changes per kind
+type ChangesSummary struct {
+	Added    int
+	Modified int
+	Deleted  int
+}
+
+// ContainerChanges is the filesystem diff of a container
+type ContainerChanges struct {
+	Changes []ContainerChange
+	Summary ChangesSummary
+}
+
+// ContainerChanges returns the filesystem changes of a container relative to
+// its image, optionally limited to the paths under the repeated path
+// parameter and to the kinds given by the repeated kind parameter
+func (a *API) ContainerChanges(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	prefixes := r.URL.Query()["path"]
+
+	kinds := make(map[string]bool)
+	for _, kind := range r.URL.Query()["kind"] {
+		switch kind {
+		case "added", "modified", "deleted":
+			kinds[kind] = true
+		default:
+			write(w, http.StatusBadRequest, Response{Error: "invalid kind parameter: " + strconv.Quote(kind)})
+			return
+		}
+	}
+
+	changes, err := a.client.ContainerChanges(id)
+	if err != nil {
+		writeError(w, err, kindContainer, id)
+		return
+	}
+
+	result := ContainerChanges{Changes: []ContainerChange{}}
+	for _, c := range changes {
+		if len(prefixes) > 0 && !hasPathPrefix(c.Path, prefixes) {
+			continue
+		}
+
+		var kind string
+		switch c.Kind {
+		case docker.ChangeAdd:
+			kind = "added"
+		case docker.ChangeModify:
+			kind = "modified"
+		case docker.ChangeDelete:
+			kind = "deleted"
+		}
+
+		if len(kinds) > 0 && !kinds[kind] {
+			continue
+		}
+
+		switch kind {
+		case "added":
+			result.Summary.Added++
+		case "modified":
+			result.Summary.Modified++
+		case "deleted":
+			result.Summary.Deleted++
+		}
+
+		result.Changes = append(result.Changes, ContainerChange{Path: c.Path, Kind: kind})
+	}
+
+	write(w, http.StatusOK, result)
+}
+
+// hasPathPrefix reports whether p is one of prefixes or lies below one of them
+func hasPathPrefix(p string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if prefix == "" || p == prefix || strings.HasPrefix(p, prefix+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CommitContainerRequest is the body of a commit request. Changes are
+// Dockerfile instructions applied to the new image, e.g. "ENV DEBUG=1"
+type CommitContainerRequest struct {
+	Repository string
+	Tag        string
+	Author     string
+	Message    string
+	Pause      *bool
+	Changes    []string
+}
+
+// CommitResult is the outcome of a commit
+type CommitResult struct {
+	ID    string
+	Image string `json:",omitempty"`
+}
+
+// commitInstructions are the Dockerfile instructions docker accepts as commit changes
+var commitInstructions = map[string]bool{
+	"CMD": true, "ENTRYPOINT": true, "ENV": true, "EXPOSE": true, "LABEL": true,
+	"ONBUILD": true, "STOPSIGNAL": true, "USER": true, "VOLUME": true, "WORKDIR": true,
+}
+
+// CommitContainer creates a new image from a container. The container is
+// paused while committing unless Pause is false
+func (a *API) CommitContainer(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	var c CommitContainerRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil && !errors.Is(err, io.EOF) {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	for _, change := range c.Changes {
+		instruction, _, _ := strings.Cut(strings.TrimSpace(change), " ")
+		if !commitInstructions[strings.ToUpper(instruction)] {
+			write(w, http.StatusBadRequest, Response{Error: "unsupported change: " + strconv.Quote(change)})
+			return
+		}
+	}
+
+	if c.Repository != "" && c.Tag == "" {
+		c.Repository, c.Tag = splitImageRef(c.Repository)
+	}
+
+	// go-dockerclient does not pass pause, so the daemon is called directly
+	params := url.Values{
+		"container": {id},
+		"pause":     {strconv.FormatBool(c.Pause == nil || *c.Pause)},
+		"changes":   c.Changes,
+	}
+	if c.Repository != "" {
+		params.Set("repo", c.Repository)
+		params.Set("tag", c.Tag)
+	}
+	if c.Author != "" {
+		params.Set("author", c.Author)
+	}
+	if c.Message != "" {
+		params.Set("comment", c.Message)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 60*time.Second)
+	defer cancel()
+
+	resp, err := a.daemonRequest(ctx, http.MethodPost, "/commit", params, nil)
+	if err != nil {
+		writeError(w, err, kindContainer, id)
+		return
+	}
+	defer resp.Body.Close()
+
+	var image struct{ ID string }
+	if err = json.NewDecoder(resp.Body).Decode(&image); err != nil {
+		writeError(w, err, kindContainer, id)
+		return
+	}
+
+	result := CommitResult{ID: image.ID}
+	if c.Repository != "" {
+		result.Image = c.Repository + ":" + c.Tag
+	}
+
+	write(w, http.StatusOK, result)
+}
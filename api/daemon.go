@@ -0,0 +1,75 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// daemonRequest sends a request straight to the docker daemon, for the few
+// API parameters go-dockerclient does not expose. It reuses the client's HTTP
+// transport, so unix sockets and TLS work the same way. Error responses are
+// returned as *docker.Error
+func (a *API) daemonRequest(ctx context.Context, method, path string, query url.Values, body io.Reader) (*http.Response, error) {
+	return a.daemonDo(ctx, method, path, query, body, "application/x-tar")
+}
+
+// daemonJSON sends a request with a JSON body straight to the docker daemon,
+// for the calls go-dockerclient makes without a context
+func (a *API) daemonJSON(ctx context.Context, method, path string, query url.Values, v any) (*http.Response, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.daemonDo(ctx, method, path, query, bytes.NewReader(data), "application/json")
+}
+
+// daemonDo sends a request to the docker daemon with a body of contentType
+func (a *API) daemonDo(ctx context.Context, method, path string, query url.Values, body io.Reader, contentType string) (*http.Response, error) {
+	endpoint, err := url.Parse(a.client.Endpoint())
+	if err != nil {
+		return nil, err
+	}
+
+	u := url.URL{Scheme: "http", Host: endpoint.Host, Path: path, RawQuery: query.Encode()}
+	switch {
+	case endpoint.Scheme == "unix":
+		u.Host = "unix.sock"
+	case a.client.TLSConfig != nil:
+		u.Scheme = "https"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := a.client.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+
+		var msg struct{ Message string }
+		data, _ := io.ReadAll(resp.Body)
+		if err = json.Unmarshal(data, &msg); err != nil {
+			msg.Message = string(data)
+		}
+
+		return nil, &docker.Error{Status: resp.StatusCode, Message: msg.Message}
+	}
+
+	return resp, nil
+}
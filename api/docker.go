@@ -7,7 +7,7 @@ import (
 func (a *API) GetDocker(w http.ResponseWriter, _ *http.Request) {
 	docker, err := a.client.Info()
 	if err != nil {
-		write(w, http.StatusInternalServerError, Response{Error: err.Error()})
+		writeError(w, err, "", "")
 		return
 	}
 
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// Codes reported in the Code field of error responses
+const (
+	codeBadRequest        = "bad_request"
+	codeUnauthorized      = "unauthorized"
+	codeForbidden         = "forbidden"
+	codePolicyViolation   = "policy_violation"
+	codeNotFound          = "not_found"
+	codeConflict          = "conflict"
+	codeAlreadyExists     = "already_exists"
+	codeInUse             = "in_use"
+	codeNotRunning        = "not_running"
+	codeAlreadyRunning    = "already_running"
+	codeLengthRequired    = "length_required"
+	codeTimeout           = "timeout"
+	codeNotImplemented    = "not_implemented"
+	codeDaemonError       = "daemon_error"
+	codeDaemonUnavailable = "daemon_unavailable"
+	codeRegistryError     = "registry_error"
+	codeDenied            = "denied"
+	codeManifestInvalid   = "manifest_invalid"
+	codeInternal          = "internal"
+)
+
+// Kinds of the resources reported in the Kind field of error responses
+const (
+	kindContainer = "container"
+	kindExec      = "exec"
+	kindImage     = "image"
+	kindNetwork   = "network"
+	kindVolume    = "volume"
+	kindWebhook   = "webhook"
+)
+
+// statusError is an error reported with a given status and code, for failures
+// that carry no docker error type
+type statusError struct {
+	status int
+	code   string
+	err    error
+}
+
+func (e *statusError) Error() string {
+	return e.err.Error()
+}
+
+func (e *statusError) Unwrap() error {
+	return e.err
+}
+
+// withStatus makes err be reported with status and the code of that status
+func withStatus(status int, err error) error {
+	return &statusError{status: status, code: codeForStatus(status), err: err}
+}
+
+// translateError returns the status and code err is reported with
+func translateError(err error) (int, string) {
+	var (
+		se             *statusError
+		violation      *PolicyViolation
+		noContainer    *docker.NoSuchContainer
+		noExec         *docker.NoSuchExec
+		noNetwork      *docker.NoSuchNetwork
+		noNetOrCont    *docker.NoSuchNetworkOrContainer
+		notRunning     *docker.ContainerNotRunning
+		alreadyRunning *docker.ContainerAlreadyRunning
+		daemonError    *docker.Error
+	)
+
+	switch {
+	case errors.As(err, &se):
+		return se.status, se.code
+	case errors.As(err, &violation):
+		return http.StatusForbidden, codePolicyViolation
+	case errors.As(err, &noContainer), errors.As(err, &noExec), errors.As(err, &noNetwork),
+		errors.As(err, &noNetOrCont), errors.Is(err, docker.ErrNoSuchImage), errors.Is(err, docker.ErrNoSuchVolume):
+		return http.StatusNotFound, codeNotFound
+	case errors.Is(err, docker.ErrContainerAlreadyExists), errors.Is(err, docker.ErrNetworkAlreadyExists):
+		return http.StatusConflict, codeAlreadyExists
+	case errors.Is(err, docker.ErrVolumeInUse):
+		return http.StatusConflict, codeInUse
+	case errors.As(err, &notRunning):
+		return http.StatusConflict, codeNotRunning
+	case errors.As(err, &alreadyRunning):
+		return http.StatusConflict, codeAlreadyRunning
+	case errors.Is(err, docker.ErrConnectionRefused):
+		return http.StatusServiceUnavailable, codeDaemonUnavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, codeTimeout
+	case errors.As(err, &daemonError):
+		if daemonError.Status >= http.StatusInternalServerError {
+			return http.StatusInternalServerError, codeDaemonError
+		}
+
+		if daemonError.Status < http.StatusBadRequest {
+			return http.StatusInternalServerError, codeInternal
+		}
+
+		return daemonError.Status, codeForStatus(daemonError.Status)
+	default:
+		return http.StatusInternalServerError, codeInternal
+	}
+}
+
+// codeForStatus returns the code reported with a status when nothing more
+// specific is known
+func codeForStatus(status int) string {
+	switch status {
+	case http.StatusUnauthorized:
+		return codeUnauthorized
+	case http.StatusForbidden:
+		return codeForbidden
+	case http.StatusNotFound:
+		return codeNotFound
+	case http.StatusConflict:
+		return codeConflict
+	case http.StatusLengthRequired:
+		return codeLengthRequired
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return codeTimeout
+	case http.StatusNotImplemented:
+		return codeNotImplemented
+	case http.StatusServiceUnavailable:
+		return codeDaemonUnavailable
+	}
+
+	if status >= http.StatusBadRequest && status < http.StatusInternalServerError {
+		return codeBadRequest
+	}
+
+	return codeInternal
+}
+
+// errorResponse describes err for a response about the resource of the given
+// kind and id, returning the status it is reported with
+func errorResponse(err error, kind, id string) (int, Response) {
+	status, code := translateError(err)
+
+	resp := Response{Error: err.Error(), Code: code, Kind: kind, ID: id}
+
+	var violation *PolicyViolation
+	if errors.As(err, &violation) {
+		resp.Rule = violation.Rule
+	}
+
+	return status, resp
+}
+
+// writeError reports err about the resource of the given kind and id
+func writeError(w http.ResponseWriter, err error, kind, id string) {
+	status, resp := errorResponse(err, kind, id)
+	write(w, status, resp)
+}
@@ -0,0 +1,572 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+)
+
+// eventBuffer is the number of events buffered for a subscriber before it is
+// dropped for being too slow
+const eventBuffer = 256
+
+// errSubscriberTooSlow ends a subscription that fell too far behind
+var errSubscriberTooSlow = errors.New("event subscriber is too slow, events were dropped")
+
+// eventFilter holds docker style event filters. Values of the same key are
+// alternatives, different keys must all match
+type eventFilter map[string][]string
+
+// eventFilterKeys are the filters accepted by the events endpoints. action is
+// an alias of event, resource matches the ID or name of any kind of resource
+var eventFilterKeys = []string{"type", "event", "action", "resource", "container", "image", "label", "network", "volume"}
+
+// queryEventFilter builds an event filter from the query parameters
+func queryEventFilter(r *http.Request) eventFilter {
+	f := eventFilter(queryFilters(r, eventFilterKeys...))
+
+	if actions, ok := f["action"]; ok {
+		f["event"] = append(f["event"], actions...)
+		delete(f, "action")
+	}
+
+	return f
+}
+
+// Match reports whether an event passes the filter
+func (f eventFilter) Match(ev *docker.APIEvents) bool {
+	for key, values := range f {
+		matched := false
+		for _, v := range values {
+			if eventMatches(ev, key, v) {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+// eventMatches reports whether an event matches a single filter value
+func eventMatches(ev *docker.APIEvents, key, v string) bool {
+	attrs := ev.Actor.Attributes
+
+	switch key {
+	case "type":
+		return ev.Type == v
+	case "event":
+		// exec events carry the command, e.g. "exec_start: sh"
+		return ev.Action == v || strings.HasPrefix(ev.Action, v+":")
+	case "container":
+		return ev.Type == "container" &&
+			(ev.Actor.ID == v || strings.HasPrefix(ev.Actor.ID, v) || attrs["name"] == v)
+	case "image":
+		candidates := []string{attrs["image"]}
+		if ev.Type == "image" {
+			candidates = append(candidates, ev.Actor.ID, attrs["name"])
+		}
+
+		for _, c := range candidates {
+			if c == "" {
+				continue
+			}
+
+			if repository, _ := splitImageRef(c); c == v || repository == v {
+				return true
+			}
+		}
+
+		return false
+	case "label":
+		name, value, hasValue := strings.Cut(v, "=")
+		actual, ok := attrs[name]
+		return ok && (!hasValue || actual == value)
+	case "resource":
+		return ev.Actor.ID == v || strings.HasPrefix(ev.Actor.ID, v) || attrs["name"] == v
+	case "network", "volume":
+		return ev.Type == key && (ev.Actor.ID == v || attrs["name"] == v)
+	default:
+		return false
+	}
+}
+
+// eventTime returns the time of an event
+func eventTime(ev *docker.APIEvents) time.Time {
+	if ev.TimeNano != 0 {
+		return time.Unix(0, ev.TimeNano)
+	}
+
+	return time.Unix(ev.Time, 0)
+}
+
+// eventSubscription receives the events of a hub that pass its filter. C is
+// closed when the hub drops the subscription, Err then tells why
+type eventSubscription struct {
+	C      chan *docker.APIEvents
+	filter eventFilter
+	err    error
+}
+
+// Err returns the reason the subscription was dropped
+func (s *eventSubscription) Err() error {
+	return s.err
+}
+
+// eventHub fans a single daemon event subscription out to any number of
+// subscribers. The daemon subscription is opened with the first subscriber
+// and removed with the last one; when the daemon connection is lost it is
+// reopened from the last event seen
+type eventHub struct {
+	client *docker.Client
+	logger *logrus.Logger
+
+	mu       sync.Mutex
+	subs     map[*eventSubscription]struct{}
+	listener chan *docker.APIEvents
+	stop     chan struct{}
+	lastSeen int64 // TimeNano of the last event published
+}
+
+// newEventHub creates an event hub. Nothing is subscribed until the first Subscribe
+func newEventHub(client *docker.Client, logger *logrus.Logger) *eventHub {
+	return &eventHub{client: client, logger: logger, subs: make(map[*eventSubscription]struct{})}
+}
+
+// Subscribe adds a subscriber receiving the events that pass filter
+func (h *eventHub) Subscribe(filter eventFilter) (*eventSubscription, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.listener == nil {
+		if err := h.listen(""); err != nil {
+			return nil, err
+		}
+	}
+
+	sub := &eventSubscription{C: make(chan *docker.APIEvents, eventBuffer), filter: filter}
+	h.subs[sub] = struct{}{}
+
+	return sub, nil
+}
+
+// Unsubscribe removes a subscriber, closing the daemon subscription with the last one
+func (h *eventHub) Unsubscribe(sub *eventSubscription) {
+	h.mu.Lock()
+
+	delete(h.subs, sub)
+
+	if len(h.subs) > 0 || h.listener == nil {
+		h.mu.Unlock()
+		return
+	}
+
+	listener := h.listener
+	close(h.stop)
+	h.listener = nil
+	h.stop = nil
+	h.mu.Unlock()
+
+	if err := h.client.RemoveEventListener(listener); err != nil {
+		h.logger.Error(err)
+	}
+}
+
+// listen opens the daemon subscription, resuming after since when it is set.
+// h.mu must be held
+func (h *eventHub) listen(since string) error {
+	listener := make(chan *docker.APIEvents, eventBuffer)
+
+	if err := h.client.AddEventListenerWithOptions(docker.EventsOptions{Since: since}, listener); err != nil {
+		return err
+	}
+
+	h.listener = listener
+	h.stop = make(chan struct{})
+
+	go h.run(listener, h.stop)
+
+	return nil
+}
+
+// run publishes the events received on listener until stop is closed or
+// go-dockerclient gives up on the daemon connection and closes listener
+func (h *eventHub) run(listener chan *docker.APIEvents, stop chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case ev, ok := <-listener:
+			if !ok {
+				h.reconnect(listener)
+				return
+			}
+
+			if ev != docker.EOFEvent {
+				h.publish(ev)
+			}
+		}
+	}
+}
+
+// publish passes an event to every subscriber whose filter it passes.
+// Subscribers whose buffer is full are dropped rather than slowing down the others
+func (h *eventHub) publish(ev *docker.APIEvents) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// a reconnect resumes at the second of the last event, skip what was already seen
+	if ev.TimeNano != 0 && ev.TimeNano <= h.lastSeen {
+		return
+	}
+	h.lastSeen = max(h.lastSeen, ev.TimeNano)
+
+	for sub := range h.subs {
+		if !sub.filter.Match(ev) {
+			continue
+		}
+
+		select {
+		case sub.C <- ev:
+		default:
+			h.drop(sub, errSubscriberTooSlow)
+		}
+	}
+}
+
+// drop ends a subscription with err. h.mu must be held
+func (h *eventHub) drop(sub *eventSubscription, err error) {
+	delete(h.subs, sub)
+	sub.err = err
+	close(sub.C)
+}
+
+// reconnect reopens the daemon subscription after it was lost, retrying with
+// exponential backoff for as long as there are subscribers
+func (h *eventHub) reconnect(lost chan *docker.APIEvents) {
+	backoff := time.Second
+
+	for {
+		h.mu.Lock()
+
+		if h.listener != lost {
+			// removed by the last Unsubscribe in the meantime
+			h.mu.Unlock()
+			return
+		}
+
+		if len(h.subs) == 0 {
+			h.listener = nil
+			h.stop = nil
+			h.mu.Unlock()
+			return
+		}
+
+		since := ""
+		if h.lastSeen > 0 {
+			since = strconv.FormatInt(h.lastSeen/int64(time.Second), 10)
+		}
+
+		err := h.listen(since)
+		h.mu.Unlock()
+
+		if err == nil {
+			h.logger.Info("Docker event stream reconnected")
+			return
+		}
+
+		h.logger.Error("Docker event stream reconnect failed: ", err)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, 30*time.Second)
+	}
+}
+
+// daemonEventTime formats a time the way the daemon accepts it for since and until
+func daemonEventTime(t time.Time) string {
+	return fmt.Sprintf("%d.%09d", t.Unix(), t.Nanosecond())
+}
+
+// replayEvents reads the events between since and until from the daemon,
+// passing the ones that pass filter to fn
+func (a *API) replayEvents(ctx context.Context, since, until time.Time, filter eventFilter, fn func(ev *docker.APIEvents) error) error {
+	query := url.Values{"until": {daemonEventTime(until)}}
+	if !since.IsZero() {
+		query.Set("since", daemonEventTime(since))
+	}
+
+	resp, err := a.daemonRequest(ctx, http.MethodGet, "/events", query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var ev docker.APIEvents
+		if err = dec.Decode(&ev); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+
+			return err
+		}
+
+		if filter.Match(&ev) {
+			if err = fn(&ev); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// followEvents keeps a subscription to the event hub open for the lifetime
+// of the process and passes the events it receives to fn, those already
+// waiting in the subscription together. Every time the subscription is
+// opened, the events the daemon still has from after the time since returns
+// are passed first, so that neither a restart nor a dropped subscription
+// leaves a gap. name starts the log messages
+func (a *API) followEvents(name string, since func() (time.Time, error), fn func(events []*docker.APIEvents)) {
+	for {
+		sub, err := a.events.Subscribe(eventFilter{})
+		if err != nil {
+			a.logger.Error(name+" subscription failed: ", err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		// subscribed first, so that nothing is lost between the replay and the live events
+		replayed, err := a.replayMissed(since, fn)
+		if err != nil {
+			a.logger.Error(name+" replay failed: ", err)
+		}
+
+		for ev := range sub.C {
+			batch := slices.DeleteFunc(drainEvents(ev, sub.C, eventBuffer), func(ev *docker.APIEvents) bool {
+				return ev.TimeNano != 0 && ev.TimeNano <= replayed
+			})
+			if len(batch) > 0 {
+				fn(batch)
+			}
+		}
+
+		a.logger.Error(name+" subscription dropped: ", sub.Err())
+		a.events.Unsubscribe(sub)
+	}
+}
+
+// replayMissed passes the events the daemon still has from after the time
+// since returns up to now to fn, eventBuffer at a time, and returns the end
+// of the replay in nanoseconds. Nothing is replayed when since is zero
+func (a *API) replayMissed(since func() (time.Time, error), fn func(events []*docker.APIEvents)) (int64, error) {
+	last, err := since()
+	if err != nil || last.IsZero() {
+		return 0, err
+	}
+
+	end := time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var batch []*docker.APIEvents
+	err = a.replayEvents(ctx, last, end, eventFilter{}, func(ev *docker.APIEvents) error {
+		if !eventTime(ev).After(last) {
+			return nil
+		}
+
+		batch = append(batch, ev)
+		if len(batch) == eventBuffer {
+			fn(batch)
+			batch = nil
+		}
+
+		return nil
+	})
+	if len(batch) > 0 {
+		fn(batch)
+	}
+
+	return end.UnixNano(), err
+}
+
+// drainEvents returns first along with the events already waiting in c, max
+// events at most. Nothing is read from c beyond the returned events
+func drainEvents(first *docker.APIEvents, c <-chan *docker.APIEvents, max int) []*docker.APIEvents {
+	batch := []*docker.APIEvents{first}
+
+	for len(batch) < max {
+		select {
+		case ev, ok := <-c:
+			if !ok {
+				return batch
+			}
+
+			batch = append(batch, ev)
+		default:
+			return batch
+		}
+	}
+
+	return batch
+}
+
+// Events streams docker events as SSE or NDJSON, or over a WebSocket when
+// the request is an upgrade. The type, event (or action), container, image,
+// label, network and volume parameters filter events like docker does and
+// resource matches any resource by ID or name. since
+// replays past events first; until ends the stream at that time, replaying
+// only when it has already passed
+func (a *API) Events(w http.ResponseWriter, r *http.Request) {
+	since, err := queryTime(r, "since")
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	until, err := queryTime(r, "until")
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	filter := queryEventFilter(r)
+
+	now := time.Now()
+	live := until.IsZero() || until.After(now)
+
+	// subscribe before replaying, so that nothing is lost in between
+	var sub *eventSubscription
+	if live {
+		if sub, err = a.events.Subscribe(filter); err != nil {
+			writeError(w, err, "", "")
+			return
+		}
+		defer a.events.Unsubscribe(sub)
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	var send func(ev *docker.APIEvents) error
+	var fail func(err error)
+
+	if websocket.IsWebSocketUpgrade(r) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			a.logger.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		// hijacked connections do not cancel the request context, the reader notices the client leaving
+		go func() {
+			defer cancel()
+
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+
+		send = func(ev *docker.APIEvents) error {
+			return conn.WriteJSON(ev)
+		}
+		fail = func(err error) {
+			_, resp := errorResponse(err, "", "")
+			_ = conn.WriteJSON(resp)
+		}
+
+		defer func() {
+			_ = conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+		}()
+	} else {
+		stream := newEventStream(w, r)
+		defer stream.Close()
+
+		if err = stream.Open(); err != nil {
+			return
+		}
+
+		send = func(ev *docker.APIEvents) error {
+			return stream.Send("event", ev)
+		}
+		fail = func(err error) {
+			stream.Error(err, "", "")
+		}
+	}
+
+	// events up to the replay end are delivered by the replay, skip them live
+	var replayed int64
+	if !since.IsZero() || !live {
+		end := now
+		if !live {
+			end = until
+		}
+
+		err = a.replayEvents(ctx, since, end, filter, send)
+		if err != nil {
+			if ctx.Err() == nil {
+				fail(err)
+			}
+			return
+		}
+
+		replayed = end.UnixNano()
+	}
+
+	if !live {
+		return
+	}
+
+	var deadline <-chan time.Time
+	if !until.IsZero() {
+		timer := time.NewTimer(time.Until(until))
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-deadline:
+			return
+		case ev, ok := <-sub.C:
+			if !ok {
+				fail(sub.Err())
+				return
+			}
+
+			if ev.TimeNano != 0 && ev.TimeNano <= replayed {
+				continue
+			}
+
+			if !until.IsZero() && eventTime(ev).After(until) {
+				return
+			}
+
+			if err = send(ev); err != nil {
+				return
+			}
+		}
+	}
+}
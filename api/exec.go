@@ -0,0 +1,221 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/go-chi/chi/v5"
+)
+
+// ExecResult is the outcome of an exec session
+type ExecResult struct {
+	ID       string
+	ExitCode int
+	Stdout   string `json:",omitempty"`
+	Stderr   string `json:",omitempty"`
+}
+
+// CreateExec creates an exec session in a container. Stdout and stderr are
+// attached when the request does not attach any stream
+func (a *API) CreateExec(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	var c docker.CreateExecOptions
+
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	if len(c.Cmd) == 0 {
+		write(w, http.StatusBadRequest, Response{Error: "Cmd is required"})
+		return
+	}
+
+	if err := a.policy.AdmitExec(&c); err != nil {
+		writeError(w, err, kindContainer, id)
+		return
+	}
+
+	if !c.AttachStdin && !c.AttachStdout && !c.AttachStderr {
+		c.AttachStdout = true
+		c.AttachStderr = true
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	c.Container = id
+	c.Context = ctx
+
+	exec, err := a.client.CreateExec(c)
+	if err != nil {
+		writeError(w, err, kindContainer, id)
+		return
+	}
+
+	write(w, http.StatusOK, exec)
+}
+
+// InspectExec inspects an exec session
+func (a *API) InspectExec(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	exec, err := a.client.InspectExec(id)
+	if err != nil {
+		writeError(w, err, kindExec, id)
+		return
+	}
+
+	write(w, http.StatusOK, exec)
+}
+
+// StartExec starts an exec session. By default it waits for the command to
+// exit and returns its exit code with the captured stdout and stderr;
+// stream=true streams the output instead and detach=true returns immediately.
+// The request body is used as stdin when the session was created with AttachStdin
+func (a *API) StartExec(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	detach, err := queryBool(r, "detach", false)
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	streaming, err := queryBool(r, "stream", false)
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	exec, err := a.client.InspectExec(id)
+	if err != nil {
+		writeError(w, err, kindExec, id)
+		return
+	}
+
+	if exec.Running {
+		write(w, http.StatusConflict, Response{Error: "Exec " + id + " is already running", Code: codeAlreadyRunning, Kind: kindExec, ID: id})
+		return
+	}
+
+	opts := docker.StartExecOptions{
+		Tty:         exec.ProcessConfig.Tty,
+		RawTerminal: exec.ProcessConfig.Tty,
+		Context:     r.Context(),
+	}
+
+	if detach {
+		opts.Detach = true
+
+		if _, err = a.client.StartExecNonBlocking(id, opts); err != nil {
+			writeError(w, err, kindExec, id)
+			return
+		}
+
+		write(w, http.StatusOK, Response{Message: "Exec started"})
+		return
+	}
+
+	if exec.OpenStdin {
+		opts.InputStream = r.Body
+	}
+
+	var stdout, stderr bytes.Buffer
+	stream := newEventStream(w, r)
+	defer stream.Close()
+
+	if streaming {
+		emit := func(name string) io.Writer {
+			return &lineWriter{fn: func(line []byte) error {
+				return stream.Send(name, LogLine{Stream: name, Line: string(line)})
+			}}
+		}
+
+		opts.OutputStream = emit("stdout")
+		opts.ErrorStream = emit("stderr")
+	} else {
+		opts.OutputStream = &stdout
+		opts.ErrorStream = &stderr
+	}
+
+	cw, err := a.client.StartExecNonBlocking(id, opts)
+	if err != nil {
+		writeError(w, err, kindExec, id)
+		return
+	}
+
+	if err = waitOrClose(r.Context(), cw); err != nil {
+		if r.Context().Err() != nil {
+			return
+		}
+
+		stream.Error(err, kindExec, id)
+		return
+	}
+
+	if streaming {
+		for _, lw := range []io.Writer{opts.OutputStream, opts.ErrorStream} {
+			_ = lw.(*lineWriter).Flush()
+		}
+	}
+
+	exec, err = a.client.InspectExec(id)
+	if err != nil {
+		stream.Error(err, kindExec, id)
+		return
+	}
+
+	result := ExecResult{ID: id, ExitCode: exec.ExitCode}
+
+	if streaming {
+		_ = stream.Send("exit", result)
+		return
+	}
+
+	result.Stdout = stdout.String()
+	result.Stderr = stderr.String()
+
+	write(w, http.StatusOK, result)
+}
+
+// ResizeExecTTY resizes the tty of an exec session
+func (a *API) ResizeExecTTY(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	var c struct{ Height, Width int }
+
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	if err := a.client.ResizeExecTTY(id, c.Height, c.Width); err != nil {
+		writeError(w, err, kindExec, id)
+		return
+	}
+
+	write(w, http.StatusOK, Response{Message: "Exec resized"})
+}
+
+// waitOrClose waits for a hijacked session to finish, closing it when ctx is done
+func waitOrClose(ctx context.Context, cw docker.CloseWaiter) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- cw.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		_ = cw.Close()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,260 @@
+package api
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/go-chi/chi/v5"
+)
+
+// pathStatHeader is the header the docker daemon uses to describe an archive path
+const pathStatHeader = "X-Docker-Container-Path-Stat"
+
+// PathStat describes a path inside a container
+type PathStat struct {
+	Name       string      `json:"name"`
+	Size       int64       `json:"size"`
+	Mode       os.FileMode `json:"mode"`
+	Mtime      time.Time   `json:"mtime"`
+	LinkTarget string      `json:"linkTarget"`
+}
+
+// statContainerPath returns the stat of a path inside a container along with
+// the raw header it was decoded from
+func (a *API) statContainerPath(ctx context.Context, id, p string) (*PathStat, string, error) {
+	resp, err := a.daemonRequest(ctx, http.MethodHead, "/containers/"+id+"/archive", url.Values{"path": {p}}, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	header := resp.Header.Get(pathStatHeader)
+
+	data, err := base64.StdEncoding.DecodeString(header)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var stat PathStat
+	if err = json.Unmarshal(data, &stat); err != nil {
+		return nil, "", err
+	}
+
+	return &stat, header, nil
+}
+
+// setPathStatHeaders describes a container path in the response headers
+func setPathStatHeaders(w http.ResponseWriter, stat *PathStat, header string) {
+	w.Header().Set(pathStatHeader, header)
+	w.Header().Set("X-Path-Name", stat.Name)
+	w.Header().Set("X-Path-Size", strconv.FormatInt(stat.Size, 10))
+	w.Header().Set("X-Path-Mode", stat.Mode.String())
+	w.Header().Set("X-Path-Mtime", stat.Mtime.Format(time.RFC3339))
+	if stat.LinkTarget != "" {
+		w.Header().Set("X-Path-Link-Target", stat.LinkTarget)
+	}
+}
+
+// StatContainerPath describes a path inside a container in the response headers
+func (a *API) StatContainerPath(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	p := r.URL.Query().Get("path")
+	if p == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	stat, header, err := a.statContainerPath(ctx, id, p)
+	if err != nil {
+		status, _ := translateError(err)
+		w.WriteHeader(status)
+		return
+	}
+
+	setPathStatHeaders(w, stat, header)
+	w.WriteHeader(http.StatusOK)
+}
+
+// DownloadFromContainer downloads a path from a container as a tar. With
+// raw=true a regular file is sent as is instead
+func (a *API) DownloadFromContainer(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	p := r.URL.Query().Get("path")
+	if p == "" {
+		write(w, http.StatusBadRequest, Response{Error: "path is required"})
+		return
+	}
+
+	raw, err := queryBool(r, "raw", false)
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	aw, err := newArchiveWriter(w, r, path.Base(p))
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	stat, header, err := a.statContainerPath(ctx, id, p)
+	if err != nil {
+		writeError(w, err, kindContainer, id)
+		return
+	}
+
+	if raw && !stat.Mode.IsRegular() {
+		write(w, http.StatusBadRequest, Response{Error: p + " is not a regular file"})
+		return
+	}
+
+	setPathStatHeaders(w, stat, header)
+
+	ctx, cancel = context.WithCancel(r.Context())
+	defer cancel()
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(a.client.DownloadFromContainer(id, docker.DownloadFromContainerOptions{
+			OutputStream: pw,
+			Path:         p,
+			Context:      ctx,
+		}))
+	}()
+
+	if raw {
+		err = copyFileFromTar(w, pr, stat)
+	} else {
+		if _, err = io.Copy(aw, pr); err == nil {
+			err = aw.Close()
+		}
+	}
+	_ = pr.CloseWithError(err)
+
+	if err != nil {
+		if r.Context().Err() != nil {
+			return
+		}
+
+		a.abortArchive(aw, err)
+		writeError(w, err, kindContainer, id)
+	}
+}
+
+// copyFileFromTar sends the first file of a tar stream to the client
+func copyFileFromTar(w http.ResponseWriter, r io.Reader, stat *PathStat) error {
+	tr := tar.NewReader(r)
+
+	if _, err := tr.Next(); err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", stat.Name))
+	w.Header().Set("Content-Length", strconv.FormatInt(stat.Size, 10))
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := io.Copy(w, tr); err != nil {
+		panic(http.ErrAbortHandler)
+	}
+
+	return nil
+}
+
+// UploadToContainer extracts the tar (optionally compressed) sent as the
+// request body into path inside a container. With name set, the body is
+// stored as a single file called name in path instead, with an optional
+// octal mode
+func (a *API) UploadToContainer(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	p := r.URL.Query().Get("path")
+	if p == "" {
+		write(w, http.StatusBadRequest, Response{Error: "path is required"})
+		return
+	}
+
+	noOverwrite, err := queryBool(r, "noOverwriteDirNonDir", false)
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	body := io.Reader(r.Body)
+
+	if name := r.URL.Query().Get("name"); name != "" {
+		if r.ContentLength < 0 {
+			write(w, http.StatusLengthRequired, Response{Error: "Content-Length is required to upload a single file"})
+			return
+		}
+
+		mode := int64(0o644)
+		if v := r.URL.Query().Get("mode"); v != "" {
+			if mode, err = strconv.ParseInt(v, 8, 32); err != nil {
+				write(w, http.StatusBadRequest, Response{Error: "invalid mode parameter: " + strconv.Quote(v)})
+				return
+			}
+		}
+
+		pr, pw := io.Pipe()
+		defer pr.Close()
+
+		go func() {
+			pw.CloseWithError(writeSingleFileTar(pw, r.Body, &tar.Header{
+				Name:    path.Base(name),
+				Mode:    mode,
+				Size:    r.ContentLength,
+				ModTime: time.Now(),
+			}))
+		}()
+
+		body = pr
+	}
+
+	err = a.client.UploadToContainer(id, docker.UploadToContainerOptions{
+		InputStream:          body,
+		Path:                 p,
+		NoOverwriteDirNonDir: noOverwrite,
+		Context:              r.Context(),
+	})
+	if err != nil {
+		writeError(w, err, kindContainer, id)
+		return
+	}
+
+	write(w, http.StatusOK, Response{Message: "Archive uploaded"})
+}
+
+// writeSingleFileTar writes a tar holding a single file read from r
+func writeSingleFileTar(w io.Writer, r io.Reader, hdr *tar.Header) error {
+	tw := tar.NewWriter(w)
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	if _, err := io.CopyN(tw, r, hdr.Size); err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
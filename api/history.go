@@ -0,0 +1,319 @@
+package api
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	bolt "go.etcd.io/bbolt"
+)
+
+// eventsBucket holds the recorded events keyed by time and sequence
+var eventsBucket = []byte("events")
+
+const (
+	// defaultHistoryLimit is the page size of history queries without a limit
+	defaultHistoryLimit = 100
+
+	// maxHistoryLimit bounds the page size of history queries
+	maxHistoryLimit = 1000
+)
+
+// EventRetention bounds the event history. Zero values do not limit it
+type EventRetention struct {
+	MaxAge    time.Duration
+	MaxEvents int
+}
+
+// EventStore is a persistent history of docker events kept in a bbolt file.
+// Keys are the big endian event time in nanoseconds followed by a sequence
+// number, so the events are stored in time order
+type EventStore struct {
+	db        *bolt.DB
+	retention EventRetention
+}
+
+// OpenEventStore opens or creates an event store at path
+func OpenEventStore(path string, retention EventRetention) (*EventStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(eventsBucket)
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return &EventStore{db: db, retention: retention}, nil
+}
+
+// Close closes the store
+func (s *EventStore) Close() error {
+	return s.db.Close()
+}
+
+// eventKey returns the time prefix of the keys of events recorded at t
+func eventKey(t time.Time) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+
+	return key
+}
+
+// Add records events in a single transaction
+func (s *EventStore) Add(events ...*docker.APIEvents) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(eventsBucket)
+
+		for _, ev := range events {
+			seq, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+
+			data, err := json.Marshal(ev)
+			if err != nil {
+				return err
+			}
+
+			key := binary.BigEndian.AppendUint64(eventKey(eventTime(ev)), seq)
+			if err = b.Put(key, data); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// EventQuery selects recorded events. Zero times leave the range open, a
+// zero limit returns every event after offset
+type EventQuery struct {
+	Since  time.Time
+	Until  time.Time
+	Filter eventFilter
+	Desc   bool // newest first
+	Offset int
+	Limit  int
+}
+
+// Query returns the events selected by q. The store is walked with a cursor
+// in the requested order, so only the events up to offset plus limit are read
+func (s *EventStore) Query(q EventQuery) ([]docker.APIEvents, error) {
+	events := []docker.APIEvents{}
+
+	var start, end []byte
+	if !q.Since.IsZero() {
+		start = eventKey(q.Since)
+	}
+	if !q.Until.IsZero() {
+		end = eventKey(q.Until.Add(time.Nanosecond))
+	}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(eventsBucket).Cursor()
+
+		var k, v []byte
+		next := c.Next
+		switch {
+		case q.Desc:
+			next = c.Prev
+			if end == nil {
+				k, v = c.Last()
+			} else if k, v = c.Seek(end); k == nil {
+				k, v = c.Last()
+			} else {
+				k, v = c.Prev()
+			}
+		case start == nil:
+			k, v = c.First()
+		default:
+			k, v = c.Seek(start)
+		}
+
+		skipped := 0
+		for ; k != nil; k, v = next() {
+			if (start != nil && bytes.Compare(k, start) < 0) || (end != nil && bytes.Compare(k, end) >= 0) {
+				break
+			}
+
+			// without a filter every event counts, skip them undecoded
+			if len(q.Filter) == 0 && skipped < q.Offset {
+				skipped++
+				continue
+			}
+
+			var ev docker.APIEvents
+			if err := json.Unmarshal(v, &ev); err != nil {
+				return err
+			}
+
+			if !q.Filter.Match(&ev) {
+				continue
+			}
+
+			if skipped < q.Offset {
+				skipped++
+				continue
+			}
+
+			events = append(events, ev)
+			if q.Limit > 0 && len(events) == q.Limit {
+				break
+			}
+		}
+
+		return nil
+	})
+
+	return events, err
+}
+
+// Last returns the time of the latest recorded event, zero when there is none
+func (s *EventStore) Last() (time.Time, error) {
+	var last time.Time
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if k, _ := tx.Bucket(eventsBucket).Cursor().Last(); k != nil {
+			last = time.Unix(0, int64(binary.BigEndian.Uint64(k[:8])))
+		}
+
+		return nil
+	})
+
+	return last, err
+}
+
+// Prune deletes the events that fall outside the retention, returning how
+// many were deleted
+func (s *EventStore) Prune() (int, error) {
+	var deleted int
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(eventsBucket)
+
+		var excess int
+		if s.retention.MaxEvents > 0 {
+			excess = b.Stats().KeyN - s.retention.MaxEvents
+		}
+
+		var cutoff []byte
+		if s.retention.MaxAge > 0 {
+			cutoff = eventKey(time.Now().Add(-s.retention.MaxAge))
+		}
+
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.First() {
+			if deleted >= excess && (cutoff == nil || bytes.Compare(k, cutoff) >= 0) {
+				break
+			}
+
+			if err := c.Delete(); err != nil {
+				return err
+			}
+			deleted++
+		}
+
+		return nil
+	})
+
+	return deleted, err
+}
+
+// SetEventStore starts recording every docker event into store. The
+// retention is applied once a minute
+func (a *API) SetEventStore(store *EventStore) {
+	a.history = store
+
+	go a.pruneEvents(store)
+
+	go a.followEvents("Event history", store.Last, func(events []*docker.APIEvents) {
+		if err := store.Add(events...); err != nil {
+			a.logger.Error("Event history write failed: ", err)
+		}
+	})
+}
+
+// pruneEvents applies the retention of store for the lifetime of the process
+func (a *API) pruneEvents(store *EventStore) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for ; ; <-ticker.C {
+		if n, err := store.Prune(); err != nil {
+			a.logger.Error("Event history prune failed: ", err)
+		} else if n > 0 {
+			a.logger.Debug("Event history pruned: ", n)
+		}
+	}
+}
+
+// EventHistory returns recorded docker events. since and until bound the
+// time range and the filters of the events endpoint apply. Events are sorted
+// newest first unless order=asc and paginated with limit (100 by default,
+// 1000 at most) and offset. Pages are read straight from the store, so no
+// total count is reported
+func (a *API) EventHistory(w http.ResponseWriter, r *http.Request) {
+	if a.history == nil {
+		write(w, http.StatusNotImplemented, Response{Error: "Event history is not enabled"})
+		return
+	}
+
+	since, err := queryTime(r, "since")
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	until, err := queryTime(r, "until")
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	_, desc, err := querySort(r, "time")
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	limit, err := queryInt(r, "limit", defaultHistoryLimit)
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+	limit = min(limit, maxHistoryLimit)
+
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	events, err := a.history.Query(EventQuery{
+		Since:  since,
+		Until:  until,
+		Filter: queryEventFilter(r),
+		Desc:   desc,
+		Offset: offset,
+		Limit:  limit,
+	})
+	if err != nil {
+		writeError(w, err, "", "")
+		return
+	}
+
+	write(w, http.StatusOK, events)
+}
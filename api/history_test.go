@@ -0,0 +1,244 @@
+package api
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// testEventBase is the time of the first test event, later ones follow a second apart
+var testEventBase = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func testEvent(i int, action string) *docker.APIEvents {
+	t := testEventBase.Add(time.Duration(i) * time.Second)
+
+	return &docker.APIEvents{
+		Type:     "container",
+		Action:   action,
+		Actor:    docker.APIActor{ID: "c" + string(rune('a'+i))},
+		Time:     t.Unix(),
+		TimeNano: t.UnixNano(),
+	}
+}
+
+func openTestStore(t *testing.T, retention EventRetention) *EventStore {
+	t.Helper()
+
+	store, err := OpenEventStore(filepath.Join(t.TempDir(), "events.db"), retention)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	return store
+}
+
+// eventIDs returns the actor IDs of events, in order
+func eventIDs(events []docker.APIEvents) []string {
+	ids := make([]string, 0, len(events))
+	for _, ev := range events {
+		ids = append(ids, ev.Actor.ID)
+	}
+
+	return ids
+}
+
+func TestDrainEvents(t *testing.T) {
+	c := make(chan *docker.APIEvents, 8)
+	for i := 1; i <= 5; i++ {
+		c <- testEvent(i, "start")
+	}
+
+	batch := drainEvents(testEvent(0, "start"), c, 4)
+	if len(batch) != 4 {
+		t.Fatalf("batch has %d events, want 4", len(batch))
+	}
+
+	for i, ev := range batch {
+		if want := testEvent(i, "start").Actor.ID; ev.Actor.ID != want {
+			t.Fatalf("event %d is %s, want %s", i, ev.Actor.ID, want)
+		}
+	}
+
+	// the events beyond the cap stay in the channel
+	if len(c) != 2 {
+		t.Fatalf("%d events left in the channel, want 2", len(c))
+	}
+
+	batch = drainEvents(<-c, c, 4)
+	if len(batch) != 2 || batch[0].Actor.ID != "ce" || batch[1].Actor.ID != "cf" {
+		t.Fatalf("second batch is %v", batch)
+	}
+}
+
+func TestDrainEventsClosed(t *testing.T) {
+	c := make(chan *docker.APIEvents, 2)
+	c <- testEvent(1, "start")
+	close(c)
+
+	batch := drainEvents(testEvent(0, "start"), c, 4)
+	if len(batch) != 2 {
+		t.Fatalf("batch has %d events, want 2", len(batch))
+	}
+
+	if _, ok := <-c; ok {
+		t.Fatal("channel still open")
+	}
+}
+
+func TestEventStoreQuery(t *testing.T) {
+	store := openTestStore(t, EventRetention{})
+
+	var events []*docker.APIEvents
+	for i := 0; i < 10; i++ {
+		action := "start"
+		if i%2 == 1 {
+			action = "die"
+		}
+
+		events = append(events, testEvent(i, action))
+	}
+
+	// stored in time order whatever the insertion order
+	if err := store.Add(events[5:]...); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Add(events[:5]...); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		q    EventQuery
+		want []string
+	}{
+		{
+			name: "all",
+			q:    EventQuery{},
+			want: []string{"ca", "cb", "cc", "cd", "ce", "cf", "cg", "ch", "ci", "cj"},
+		},
+		{
+			name: "desc",
+			q:    EventQuery{Desc: true, Limit: 3},
+			want: []string{"cj", "ci", "ch"},
+		},
+		{
+			name: "range",
+			q:    EventQuery{Since: testEventBase.Add(2 * time.Second), Until: testEventBase.Add(4 * time.Second)},
+			want: []string{"cc", "cd", "ce"},
+		},
+		{
+			name: "range desc",
+			q:    EventQuery{Since: testEventBase.Add(2 * time.Second), Until: testEventBase.Add(4 * time.Second), Desc: true},
+			want: []string{"ce", "cd", "cc"},
+		},
+		{
+			name: "until past the end desc",
+			q:    EventQuery{Until: testEventBase.Add(time.Hour), Desc: true, Limit: 2},
+			want: []string{"cj", "ci"},
+		},
+		{
+			name: "offset",
+			q:    EventQuery{Offset: 8},
+			want: []string{"ci", "cj"},
+		},
+		{
+			name: "offset and limit desc",
+			q:    EventQuery{Desc: true, Offset: 2, Limit: 2},
+			want: []string{"ch", "cg"},
+		},
+		{
+			name: "filter",
+			q:    EventQuery{Filter: eventFilter{"event": {"die"}}, Offset: 1, Limit: 2},
+			want: []string{"cd", "cf"},
+		},
+		{
+			name: "empty range",
+			q:    EventQuery{Since: testEventBase.Add(time.Hour)},
+			want: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := store.Query(tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if ids := eventIDs(got); !slices.Equal(ids, tt.want) {
+				t.Fatalf("got %v, want %v", ids, tt.want)
+			}
+		})
+	}
+
+	last, err := store.Last()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := testEventBase.Add(9 * time.Second); !last.Equal(want) {
+		t.Fatalf("last is %v, want %v", last, want)
+	}
+}
+
+func TestEventStorePrune(t *testing.T) {
+	store := openTestStore(t, EventRetention{MaxEvents: 3})
+
+	for i := 0; i < 5; i++ {
+		if err := store.Add(testEvent(i, "start")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := store.Prune()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 2 {
+		t.Fatalf("pruned %d events, want 2", n)
+	}
+
+	got, err := store.Query(EventQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := eventIDs(got); !slices.Equal(ids, []string{"cc", "cd", "ce"}) {
+		t.Fatalf("kept %v", ids)
+	}
+}
+
+func TestEventStorePruneAge(t *testing.T) {
+	store := openTestStore(t, EventRetention{MaxAge: time.Hour})
+
+	old := testEvent(0, "start")
+	recent := testEvent(1, "start")
+	recent.TimeNano = time.Now().Add(-time.Minute).UnixNano()
+
+	if err := store.Add(old, recent); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := store.Prune()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 1 {
+		t.Fatalf("pruned %d events, want 1", n)
+	}
+
+	got, err := store.Query(EventQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := eventIDs(got); !slices.Equal(ids, []string{"cb"}) {
+		t.Fatalf("kept %v", ids)
+	}
+}
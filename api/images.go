@@ -1,36 +1,96 @@
 package api
 
 import (
+	"cmp"
 	"context"
+	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	docker "github.com/fsouza/go-dockerclient"
 	"github.com/go-chi/chi/v5"
 )
 
-// ListImages returns the list of images
+// ListImages returns the list of images. The dangling, label, reference,
+// before and since parameters map to docker filters; all=true includes
+// intermediate images. The result can be sorted by created, name or size and
+// paginated with limit and offset
 func (a *API) ListImages(w http.ResponseWriter, r *http.Request) {
+	all, err := queryBool(r, "all", false)
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	field, desc, err := querySort(r, "created", "name", "size")
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
 	images, err := a.client.ListImages(docker.ListImagesOptions{
+		All:     all,
+		Filters: queryFilters(r, "dangling", "label", "reference", "before", "since"),
 		Context: ctx,
 	})
 	if err != nil {
-		write(w, http.StatusInternalServerError, Response{Error: err.Error()})
+		writeError(w, err, "", "")
+		return
+	}
+
+	if field != "" {
+		slices.SortStableFunc(images, func(x, y docker.APIImages) int {
+			var c int
+			switch field {
+			case "created":
+				c = cmp.Compare(x.Created, y.Created)
+			case "name":
+				c = cmp.Compare(imageName(x), imageName(y))
+			case "size":
+				c = cmp.Compare(x.Size, y.Size)
+			}
+
+			if desc {
+				return -c
+			}
+
+			return c
+		})
+	}
+
+	images, err = paginate(w, r, images)
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
 		return
 	}
 
 	write(w, http.StatusOK, images)
 }
 
+// imageName returns the first tag of an image
+func imageName(i docker.APIImages) string {
+	if len(i.RepoTags) == 0 {
+		return ""
+	}
+
+	return i.RepoTags[0]
+}
+
 // ImageHistory returns the history of an image
 func (a *API) ImageHistory(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	history, err := a.client.ImageHistory(id)
 	if err != nil {
-		write(w, http.StatusInternalServerError, Response{Error: err.Error()})
+		writeError(w, err, kindImage, id)
 		return
 	}
 
@@ -42,7 +102,7 @@ func (a *API) RemoveImage(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	err := a.client.RemoveImage(id)
 	if err != nil {
-		write(w, http.StatusInternalServerError, Response{Error: err.Error()})
+		writeError(w, err, kindImage, id)
 		return
 	}
 
@@ -59,7 +119,7 @@ func (a *API) RemoveImageExtended(w http.ResponseWriter, r *http.Request) {
 		NoPrune: noprune,
 	})
 	if err != nil {
-		write(w, http.StatusInternalServerError, Response{Error: err.Error()})
+		writeError(w, err, kindImage, id)
 		return
 	}
 
@@ -71,116 +131,621 @@ func (a *API) InspectImage(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	image, err := a.client.InspectImage(id)
 	if err != nil {
-		write(w, http.StatusInternalServerError, Response{Error: err.Error()})
+		writeError(w, err, kindImage, id)
 		return
 	}
 
 	write(w, http.StatusOK, image)
 }
 
-// PushImage pushes an image
+// PushImageRequest is the body of a push request. Credentials are taken from
+// Auth, or from the server-side docker config entry named by AuthRef
+type PushImageRequest struct {
+	Name    string
+	Tag     string
+	Auth    *docker.AuthConfiguration
+	AuthRef string
+}
+
+// PushResult is the outcome of a push
+type PushResult struct {
+	Image  string
+	Tag    string
+	Digest string
+	Size   int64
+}
+
+// PushImage pushes a tagged image to its registry. The image name is taken
+// from the body or the URL. With stream=true the daemon progress messages are
+// streamed as SSE or NDJSON
 func (a *API) PushImage(w http.ResponseWriter, r *http.Request) {
-	//id := chi.URLParam(r, "id")
-	//err := a.client.PushImage(docker.PushImageOptions{}, docker.AuthConfiguration{})
-	//if err != nil {
-	//	write(w, http.StatusInternalServerError, Response{Error: err.Error()})
-	//	return
-	//}
-	//
-	//write(w, http.StatusOK, Response{Message: "Image pushed"})
+	var c PushImageRequest
 
-	write(w, http.StatusNotImplemented, Response{Error: "Not implemented"})
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil && !errors.Is(err, io.EOF) {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	if c.Name == "" {
+		c.Name = chi.URLParam(r, "id")
+	}
+
+	if c.Name == "" {
+		write(w, http.StatusBadRequest, Response{Error: "Name is required"})
+		return
+	}
+
+	if c.Tag == "" {
+		c.Name, c.Tag = splitImageRef(c.Name)
+	}
+
+	streaming, err := queryBool(r, "stream", false)
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	auth, err := a.registryAuth(c.Auth, c.AuthRef, c.Name)
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	stream := newEventStream(w, r)
+	defer stream.Close()
+
+	result := PushResult{Image: c.Name, Tag: c.Tag}
+	pw := newProgressWriter(func(m ProgressMessage) error {
+		if len(m.Aux) > 0 {
+			var aux struct {
+				Tag    string
+				Digest string
+				Size   int64
+			}
+			if err := json.Unmarshal(m.Aux, &aux); err == nil && aux.Digest != "" {
+				result.Digest = aux.Digest
+				result.Size = aux.Size
+			}
+		}
+
+		if !streaming {
+			return nil
+		}
+
+		return stream.Send("progress", m)
+	})
+
+	err = a.client.PushImage(docker.PushImageOptions{
+		Name:          c.Name,
+		Tag:           c.Tag,
+		OutputStream:  pw,
+		RawJSONStream: true,
+		Context:       r.Context(),
+	}, auth)
+	if err != nil {
+		if r.Context().Err() != nil {
+			return
+		}
+
+		stream.Error(err, kindImage, c.Name)
+		return
+	}
+
+	if err = pw.Err(); err != nil {
+		stream.Error(registryError(err), kindImage, c.Name)
+		return
+	}
+
+	if streaming {
+		_ = stream.Send("done", result)
+		return
+	}
+
+	write(w, http.StatusOK, result)
+}
+
+// registryError classifies an error reported by the registry during a push or
+// pull, by the status code the daemon gives it or else by its message
+func registryError(err error) error {
+	var pe *progressError
+	if errors.As(err, &pe) && pe.code >= http.StatusBadRequest {
+		switch {
+		case pe.code == http.StatusForbidden:
+			return &statusError{status: http.StatusForbidden, code: codeDenied, err: err}
+		case pe.code >= http.StatusInternalServerError:
+			return &statusError{status: http.StatusBadGateway, code: codeRegistryError, err: err}
+		default:
+			return withStatus(pe.code, err)
+		}
+	}
+
+	msg := strings.ToLower(err.Error())
+
+	switch {
+	case strings.Contains(msg, "not found"), strings.Contains(msg, "manifest unknown"),
+		strings.Contains(msg, "does not exist"), strings.Contains(msg, "no such image"):
+		return &statusError{status: http.StatusNotFound, code: codeNotFound, err: err}
+	case strings.Contains(msg, "unauthorized"), strings.Contains(msg, "authentication required"):
+		return &statusError{status: http.StatusUnauthorized, code: codeUnauthorized, err: err}
+	case strings.Contains(msg, "permission denied"):
+		// a failure of the daemon host, not of the registry
+		return err
+	case strings.Contains(msg, "denied"):
+		return &statusError{status: http.StatusForbidden, code: codeDenied, err: err}
+	case strings.Contains(msg, "manifest"):
+		return &statusError{status: http.StatusUnprocessableEntity, code: codeManifestInvalid, err: err}
+	default:
+		return &statusError{status: http.StatusBadGateway, code: codeRegistryError, err: err}
+	}
+}
+
+// PullImageRequest is the body of a pull request. Credentials are taken from
+// Auth, or from the server-side docker config entry named by AuthRef
+type PullImageRequest struct {
+	Repository string
+	Tag        string
+	Platform   string
+	Auth       *docker.AuthConfiguration
+	AuthRef    string
+}
+
+// PullResult is the outcome of a pull
+type PullResult struct {
+	Image  string
+	ID     string `json:",omitempty"`
+	Status string `json:",omitempty"`
 }
 
-// PullImage pulls an image
+// PullImage pulls an image. The repository is taken from the body or the URL.
+// With stream=true the daemon progress messages are streamed as SSE or NDJSON
 func (a *API) PullImage(w http.ResponseWriter, r *http.Request) {
-	//id := chi.URLParam(r, "id")
-	//err := a.client.PullImage(docker.PullImageOptions{}, docker.AuthConfiguration{})
-	//if err != nil {
-	//	write(w, http.StatusInternalServerError, Response{Error: err.Error()})
-	//	return
-	//}
-	//
-	//write(w, http.StatusOK, Response{Message: "Image pulled"})
+	var c PullImageRequest
 
-	write(w, http.StatusNotImplemented, Response{Error: "Not implemented"})
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil && !errors.Is(err, io.EOF) {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	if c.Repository == "" {
+		c.Repository = chi.URLParam(r, "id")
+	}
+
+	if c.Repository == "" {
+		write(w, http.StatusBadRequest, Response{Error: "Repository is required"})
+		return
+	}
+
+	if c.Tag == "" {
+		c.Repository, c.Tag = splitImageRef(c.Repository)
+	}
+
+	streaming, err := queryBool(r, "stream", false)
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	auth, err := a.registryAuth(c.Auth, c.AuthRef, c.Repository)
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	stream := newEventStream(w, r)
+	defer stream.Close()
+
+	result, err := a.pullImage(r.Context(), c.Repository, c.Tag, c.Platform, auth, func(m ProgressMessage) error {
+		if !streaming {
+			return nil
+		}
+
+		return stream.Send("progress", m)
+	})
+	if err != nil {
+		if r.Context().Err() != nil {
+			return
+		}
+
+		stream.Error(err, kindImage, c.Repository)
+		return
+	}
+
+	if streaming {
+		_ = stream.Send("done", result)
+		return
+	}
+
+	write(w, http.StatusOK, result)
+}
+
+// pullImage pulls an image, passing every progress message of the daemon to fn
+func (a *API) pullImage(ctx context.Context, repository, tag, platform string, auth docker.AuthConfiguration, fn func(m ProgressMessage) error) (PullResult, error) {
+	image := repository
+	if tag != "" {
+		image += ":" + tag
+	}
+
+	var status string
+	pw := newProgressWriter(func(m ProgressMessage) error {
+		if m.Status != "" && m.ID == "" {
+			status = m.Status
+		}
+
+		return fn(m)
+	})
+
+	err := a.client.PullImage(docker.PullImageOptions{
+		Repository:    repository,
+		Tag:           tag,
+		Platform:      platform,
+		OutputStream:  pw,
+		RawJSONStream: true,
+		Context:       ctx,
+	}, auth)
+	if err != nil {
+		return PullResult{}, err
+	}
+
+	// failures of the registry are reported in the stream
+	if err = pw.Err(); err != nil {
+		return PullResult{}, registryError(err)
+	}
+
+	result := PullResult{Image: image, Status: status}
+	if img, err := a.client.InspectImage(image); err == nil {
+		result.ID = img.ID
+	}
+
+	return result, nil
+}
+
+// LoadResult is the outcome of a load or import
+type LoadResult struct {
+	Images []string `json:",omitempty"`
+	Output []string `json:",omitempty"`
 }
 
-// LoadImage loads an image
+// LoadImage loads the images of a docker save tar sent as the request body.
+// With stream=true the daemon output is streamed as SSE or NDJSON
 func (a *API) LoadImage(w http.ResponseWriter, r *http.Request) {
-	//err := a.client.LoadImage(docker.LoadImageOptions{})
-	//if err != nil {
-	//	write(w, http.StatusInternalServerError, Response{Error: err.Error()})
-	//	return
-	//}
-	//
-	//write(w, http.StatusOK, Response{Message: "Image loaded"})
+	streaming, err := queryBool(r, "stream", false)
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
 
-	write(w, http.StatusNotImplemented, Response{Error: "Not implemented"})
+	stream := newEventStream(w, r)
+	defer stream.Close()
+
+	var result LoadResult
+	pw := newProgressWriter(func(m ProgressMessage) error {
+		line := strings.TrimRight(m.Stream, "\n")
+		if image, ok := strings.CutPrefix(line, "Loaded image: "); ok {
+			result.Images = append(result.Images, image)
+		} else if image, ok = strings.CutPrefix(line, "Loaded image ID: "); ok {
+			result.Images = append(result.Images, image)
+		}
+
+		if !streaming {
+			if line != "" {
+				result.Output = append(result.Output, line)
+			}
+			return nil
+		}
+
+		return stream.Send("progress", m)
+	})
+
+	err = a.client.LoadImage(docker.LoadImageOptions{
+		InputStream:  r.Body,
+		OutputStream: pw,
+		Context:      r.Context(),
+	})
+	if err == nil {
+		err = pw.Err()
+	}
+	if err != nil {
+		if r.Context().Err() != nil {
+			return
+		}
+
+		stream.Error(err, "", "")
+		return
+	}
+
+	if streaming {
+		_ = stream.Send("done", LoadResult{Images: result.Images})
+		return
+	}
+
+	write(w, http.StatusOK, result)
 }
 
-// ExportImage exports an image
+// ExportImage streams an image as a docker save tar
 func (a *API) ExportImage(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
-	defer cancel()
+	aw, err := newArchiveWriter(w, r, id)
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
 
-	err := a.client.ExportImage(docker.ExportImageOptions{
-		Name:    id,
-		Context: ctx,
+	err = a.client.ExportImage(docker.ExportImageOptions{
+		Name:         id,
+		OutputStream: aw,
+		Context:      r.Context(),
 	})
+	if err == nil {
+		err = aw.Close()
+	}
 	if err != nil {
-		write(w, http.StatusInternalServerError, Response{Error: err.Error()})
+		a.abortArchive(aw, err)
+
+		writeError(w, err, kindImage, id)
 		return
 	}
-
-	write(w, http.StatusOK, Response{Message: "Image exported"})
 }
 
-// ExportImages exports multiple images
+// ExportImages streams multiple images as a single docker save tar
 func (a *API) ExportImages(w http.ResponseWriter, r *http.Request) {
 	ids := r.URL.Query()["id"]
 
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
-	defer cancel()
+	if len(ids) == 0 {
+		write(w, http.StatusBadRequest, Response{Error: "id is required"})
+		return
+	}
 
-	err := a.client.ExportImages(docker.ExportImagesOptions{
-		Names:   ids,
-		Context: ctx,
-	})
+	aw, err := newArchiveWriter(w, r, "images")
 	if err != nil {
-		write(w, http.StatusInternalServerError, Response{Error: err.Error()})
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
 		return
 	}
 
-	write(w, http.StatusOK, Response{Message: "Images exported"})
+	err = a.client.ExportImages(docker.ExportImagesOptions{
+		Names:        ids,
+		OutputStream: aw,
+		Context:      r.Context(),
+	})
+	if err == nil {
+		err = aw.Close()
+	}
+	if err != nil {
+		a.abortArchive(aw, err)
+
+		writeError(w, err, kindImage, "")
+		return
+	}
 }
 
-// ImportImage imports an image
+// ImportImage creates an image from the root filesystem tar sent as the
+// request body, like docker import. The query takes repo, tag, message,
+// platform and repeated change parameters with Dockerfile instructions such
+// as CMD or ENV. With stream=true the daemon output is streamed as SSE or NDJSON
 func (a *API) ImportImage(w http.ResponseWriter, r *http.Request) {
-	//err := a.client.ImportImage(docker.ImportImageOptions{})
-	//if err != nil {
-	//	write(w, http.StatusInternalServerError, Response{Error: err.Error()})
-	//	return
-	//}
-	//
-	//write(w, http.StatusOK, Response{Message: "Image imported"})
+	query := r.URL.Query()
 
-	write(w, http.StatusNotImplemented, Response{Error: "Not implemented"})
+	streaming, err := queryBool(r, "stream", false)
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	repo := query.Get("repo")
+	if repo == "" {
+		write(w, http.StatusBadRequest, Response{Error: "repo is required"})
+		return
+	}
+
+	tag := query.Get("tag")
+	if tag == "" {
+		repo, tag = splitImageRef(repo)
+	}
+
+	// go-dockerclient does not pass changes and message, so the daemon is called directly
+	params := url.Values{
+		"fromSrc": {"-"},
+		"repo":    {repo},
+		"tag":     {tag},
+		"changes": query["change"],
+	}
+	if v := query.Get("message"); v != "" {
+		params.Set("message", v)
+	}
+	if v := query.Get("platform"); v != "" {
+		params.Set("platform", v)
+	}
+
+	resp, err := a.daemonRequest(r.Context(), http.MethodPost, "/images/create", params, r.Body)
+	if err != nil {
+		if r.Context().Err() != nil {
+			return
+		}
+
+		writeError(w, err, kindImage, repo)
+		return
+	}
+	defer resp.Body.Close()
+
+	stream := newEventStream(w, r)
+	defer stream.Close()
+
+	var result LoadResult
+	pw := newProgressWriter(func(m ProgressMessage) error {
+		if m.Status != "" && m.ID == "" {
+			result.Images = []string{m.Status}
+		}
+
+		if !streaming {
+			return nil
+		}
+
+		return stream.Send("progress", m)
+	})
+
+	if _, err = io.Copy(pw, resp.Body); err == nil {
+		err = pw.Err()
+	}
+	if err != nil {
+		if r.Context().Err() != nil {
+			return
+		}
+
+		stream.Error(err, kindImage, repo)
+		return
+	}
+
+	if streaming {
+		_ = stream.Send("done", result)
+		return
+	}
+
+	write(w, http.StatusOK, result)
 }
 
-// BuildImage builds an image
+// BuildResult is the outcome of a build
+type BuildResult struct {
+	ID     string
+	Tags   []string `json:",omitempty"`
+	Output []string `json:",omitempty"`
+}
+
+// BuildImage builds an image from the tar (optionally gzip compressed) build
+// context sent as the request body. Build options are taken from the query:
+// dockerfile, target, platform, repeated t, buildarg=KEY=VALUE and
+// label=KEY=VALUE, nocache and pull. With stream=true the build output is
+// streamed as SSE or NDJSON
 func (a *API) BuildImage(w http.ResponseWriter, r *http.Request) {
-	//err := a.client.BuildImage(docker.BuildImageOptions{})
-	//if err != nil {
-	//	write(w, http.StatusInternalServerError, Response{Error: err.Error()})
-	//	return
-	//}
-	//
-	//write(w, http.StatusOK, Response{Message: "Image built"})
+	query := r.URL.Query()
 
-	write(w, http.StatusNotImplemented, Response{Error: "Not implemented"})
+	streaming, err := queryBool(r, "stream", false)
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	noCache, err := queryBool(r, "nocache", false)
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	pull, err := queryBool(r, "pull", false)
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	var buildArgs []docker.BuildArg
+	for _, v := range query["buildarg"] {
+		name, value, ok := strings.Cut(v, "=")
+		if !ok || name == "" {
+			write(w, http.StatusBadRequest, Response{Error: "invalid buildarg parameter: " + strconv.Quote(v)})
+			return
+		}
+
+		buildArgs = append(buildArgs, docker.BuildArg{Name: name, Value: value})
+	}
+
+	labels := make(map[string]string)
+	for _, v := range query["label"] {
+		name, value, ok := strings.Cut(v, "=")
+		if !ok || name == "" {
+			write(w, http.StatusBadRequest, Response{Error: "invalid label parameter: " + strconv.Quote(v)})
+			return
+		}
+
+		labels[name] = value
+	}
+
+	tags := query["t"]
+	var name string
+	if len(tags) > 0 {
+		name = tags[0]
+	}
+
+	stream := newEventStream(w, r)
+	defer stream.Close()
+
+	var result BuildResult
+	pw := newProgressWriter(func(m ProgressMessage) error {
+		if len(m.Aux) > 0 {
+			var aux struct{ ID string }
+			if err := json.Unmarshal(m.Aux, &aux); err == nil && aux.ID != "" {
+				result.ID = aux.ID
+			}
+		}
+
+		if !streaming {
+			if line := strings.TrimRight(m.Stream, "\n"); line != "" {
+				result.Output = append(result.Output, line)
+			}
+			return nil
+		}
+
+		return stream.Send("progress", m)
+	})
+
+	err = a.client.BuildImage(docker.BuildImageOptions{
+		Context:        r.Context(),
+		Name:           name,
+		Dockerfile:     query.Get("dockerfile"),
+		Target:         query.Get("target"),
+		Platform:       query.Get("platform"),
+		Labels:         labels,
+		BuildArgs:      buildArgs,
+		NoCache:        noCache,
+		Pull:           pull,
+		RmTmpContainer: true,
+		InputStream:    r.Body,
+		OutputStream:   pw,
+		RawJSONStream:  true,
+	})
+	if err == nil {
+		err = pw.Err()
+	}
+	if err != nil {
+		if r.Context().Err() != nil {
+			return
+		}
+
+		stream.Error(err, kindImage, name)
+		return
+	}
+
+	// daemons that report no image ID in aux messages leave it to the first tag
+	if result.ID == "" && name != "" {
+		image, err := a.client.InspectImage(name)
+		if err != nil {
+			stream.Error(err, kindImage, name)
+			return
+		}
+
+		result.ID = image.ID
+	}
+
+	// the build itself only applies the first tag
+	for _, tag := range tags[min(len(tags), 1):] {
+		repo, t := splitImageRef(tag)
+
+		if err = a.client.TagImage(result.ID, docker.TagImageOptions{
+			Repo:    repo,
+			Tag:     t,
+			Force:   true,
+			Context: r.Context(),
+		}); err != nil {
+			stream.Error(err, kindImage, result.ID)
+			return
+		}
+	}
+	result.Tags = tags
+
+	if streaming {
+		_ = stream.Send("done", BuildResult{ID: result.ID, Tags: result.Tags})
+		return
+	}
+
+	write(w, http.StatusOK, result)
 }
 
 // TagImage tags an image
@@ -203,7 +768,7 @@ func (a *API) TagImage(w http.ResponseWriter, r *http.Request) {
 		Context: ctx,
 	})
 	if err != nil {
-		write(w, http.StatusInternalServerError, Response{Error: err.Error()})
+		writeError(w, err, kindImage, id)
 		return
 	}
 
@@ -216,7 +781,7 @@ func (a *API) SearchImages(w http.ResponseWriter, r *http.Request) {
 
 	results, err := a.client.SearchImages(term)
 	if err != nil {
-		write(w, http.StatusInternalServerError, Response{Error: err.Error()})
+		writeError(w, err, "", "")
 		return
 	}
 
@@ -1,16 +1,273 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
+	"net/netip"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/go-chi/chi/v5"
 )
 
+// NetworkConnectRequest is the body of a network connect request. Aliases
+// are the names the container is reachable under in the network, the
+// addresses pin it to static IPs of the network subnets
+type NetworkConnectRequest struct {
+	Container   string
+	Aliases     []string
+	Links       []string
+	IPv4Address string
+	IPv6Address string
+}
+
+// NetworkDisconnectRequest is the body of a network disconnect request
+type NetworkDisconnectRequest struct {
+	Container string
+	Force     bool
+}
+
+// networkConflict reports the conflicts of network operations, which the
+// daemon answers with 403 or 409 depending on its version, as 409 with code
+func networkConflict(err error, code string) error {
+	var e *docker.Error
+	if errors.As(err, &e) && (e.Status == http.StatusForbidden || e.Status == http.StatusConflict) {
+		return &statusError{status: http.StatusConflict, code: code, err: err}
+	}
+
+	return err
+}
+
+// noSuchNetwork reports a daemon 404 about a network as docker.NoSuchNetwork
+func noSuchNetwork(err error, id string) error {
+	var e *docker.Error
+	if errors.As(err, &e) && e.Status == http.StatusNotFound {
+		return &docker.NoSuchNetwork{ID: id}
+	}
+
+	return err
+}
+
+// checkIPAM validates the addresses of an IPAM configuration
+func checkIPAM(ipam *docker.IPAMOptions) error {
+	if ipam == nil {
+		return nil
+	}
+
+	for _, c := range ipam.Config {
+		for _, prefix := range []string{c.Subnet, c.IPRange} {
+			if prefix == "" {
+				continue
+			}
+
+			if _, err := netip.ParsePrefix(prefix); err != nil {
+				return err
+			}
+		}
+
+		if c.Gateway == "" {
+			continue
+		}
+
+		gateway, err := netip.ParseAddr(c.Gateway)
+		if err != nil {
+			return err
+		}
+
+		if c.Subnet != "" && !netip.MustParsePrefix(c.Subnet).Contains(gateway) {
+			return errors.New("gateway " + c.Gateway + " is not in subnet " + c.Subnet)
+		}
+	}
+
+	return nil
+}
+
 // GetNetworks returns the list of networks
 func (a *API) GetNetworks(w http.ResponseWriter, r *http.Request) {
 	networks, err := a.client.ListNetworks()
 	if err != nil {
-		write(w, http.StatusInternalServerError, Response{Error: err.Error()})
+		writeError(w, err, "", "")
 		return
 	}
 
 	write(w, http.StatusOK, networks)
 }
+
+// CreateNetwork creates a network. The body takes the driver, IPAM
+// configuration, internal and attachable flags, labels and driver options
+func (a *API) CreateNetwork(w http.ResponseWriter, r *http.Request) {
+	var c docker.CreateNetworkOptions
+
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	if c.Name == "" {
+		write(w, http.StatusBadRequest, Response{Error: "Name is required"})
+		return
+	}
+
+	if err := checkIPAM(c.IPAM); err != nil {
+		write(w, http.StatusBadRequest, Response{Error: "invalid IPAM configuration: " + err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	c.CheckDuplicate = true
+	c.Context = ctx
+
+	network, err := a.client.CreateNetwork(c)
+	if err != nil {
+		writeError(w, networkConflict(err, codeAlreadyExists), kindNetwork, c.Name)
+		return
+	}
+
+	write(w, http.StatusOK, network)
+}
+
+// InspectNetwork returns a network along with the containers connected to it
+func (a *API) InspectNetwork(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	// go-dockerclient inspects networks without a context
+	resp, err := a.daemonRequest(ctx, http.MethodGet, "/networks/"+id, nil, nil)
+	if err != nil {
+		writeError(w, noSuchNetwork(err, id), kindNetwork, id)
+		return
+	}
+	defer resp.Body.Close()
+
+	var network docker.Network
+	if err = json.NewDecoder(resp.Body).Decode(&network); err != nil {
+		writeError(w, err, kindNetwork, id)
+		return
+	}
+
+	write(w, http.StatusOK, network)
+}
+
+// RemoveNetwork removes a network. Networks with connected containers are
+// reported as in use
+func (a *API) RemoveNetwork(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	// go-dockerclient removes networks without a context
+	resp, err := a.daemonRequest(ctx, http.MethodDelete, "/networks/"+id, nil, nil)
+	if err != nil {
+		writeError(w, networkConflict(noSuchNetwork(err, id), codeInUse), kindNetwork, id)
+		return
+	}
+	resp.Body.Close()
+
+	write(w, http.StatusOK, Response{Message: "Network deleted"})
+}
+
+// PruneNetworks removes the networks no container is connected to. The
+// label, label! and until parameters filter them like docker does
+func (a *API) PruneNetworks(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	pruned, err := a.client.PruneNetworks(docker.PruneNetworksOptions{
+		Filters: queryFilters(r, "label", "label!", "until"),
+		Context: ctx,
+	})
+	if err != nil {
+		writeError(w, err, "", "")
+		return
+	}
+
+	write(w, http.StatusOK, pruned)
+}
+
+// ConnectNetwork connects a container to a network
+func (a *API) ConnectNetwork(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	var c NetworkConnectRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	if c.Container == "" {
+		write(w, http.StatusBadRequest, Response{Error: "Container is required"})
+		return
+	}
+
+	if addr, err := netip.ParseAddr(c.IPv4Address); c.IPv4Address != "" && (err != nil || !addr.Is4()) {
+		write(w, http.StatusBadRequest, Response{Error: "invalid IPv4Address: " + c.IPv4Address})
+		return
+	}
+
+	if addr, err := netip.ParseAddr(c.IPv6Address); c.IPv6Address != "" && (err != nil || !addr.Is6()) {
+		write(w, http.StatusBadRequest, Response{Error: "invalid IPv6Address: " + c.IPv6Address})
+		return
+	}
+
+	endpoint := &docker.EndpointConfig{Aliases: c.Aliases, Links: c.Links}
+	if c.IPv4Address != "" || c.IPv6Address != "" {
+		endpoint.IPAMConfig = &docker.EndpointIPAMConfig{IPv4Address: c.IPv4Address, IPv6Address: c.IPv6Address}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := a.client.ConnectNetwork(id, docker.NetworkConnectionOptions{
+		Container:      c.Container,
+		EndpointConfig: endpoint,
+		Context:        ctx,
+	}); err != nil {
+		writeError(w, networkConflict(err, codeConflict), kindNetwork, id)
+		return
+	}
+
+	write(w, http.StatusOK, Response{Message: "Container connected"})
+}
+
+// DisconnectNetwork disconnects a container from a network
+func (a *API) DisconnectNetwork(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	var c NetworkDisconnectRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	if c.Container == "" {
+		write(w, http.StatusBadRequest, Response{Error: "Container is required"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	// go-dockerclient sends the disconnect without a context
+	resp, err := a.daemonJSON(ctx, http.MethodPost, "/networks/"+id+"/disconnect", nil, c)
+	if err != nil {
+		var e *docker.Error
+		if errors.As(err, &e) && e.Status == http.StatusNotFound {
+			err = &docker.NoSuchNetworkOrContainer{NetworkID: id, ContainerID: c.Container}
+		}
+
+		writeError(w, networkConflict(err, codeConflict), kindNetwork, id)
+		return
+	}
+	resp.Body.Close()
+
+	write(w, http.StatusOK, Response{Message: "Container disconnected"})
+}
@@ -0,0 +1,515 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"gopkg.in/yaml.v3"
+)
+
+// Policy is an admission policy applied to container create, run, update and
+// exec requests and to volume create requests. The mutations are applied first, the rules are then checked
+// against the mutated request. The zero value allows everything
+type Policy struct {
+	DenyPrivileged     bool     `yaml:"denyPrivileged"`
+	DenyHostNetwork    bool     `yaml:"denyHostNetwork"`
+	DenyHostPID        bool     `yaml:"denyHostPID"`
+	DenyHostIPC        bool     `yaml:"denyHostIPC"`
+	DeniedBindSources  []string `yaml:"deniedBindSources"`  // exact host paths
+	DeniedBindPrefixes []string `yaml:"deniedBindPrefixes"` // host paths and everything below them
+	DeniedCapabilities []string `yaml:"deniedCapabilities"`
+	MaxMemory          int64    `yaml:"maxMemory"` // bytes
+	MaxCPUs            float64  `yaml:"maxCPUs"`
+	AllowedRegistries  []string `yaml:"allowedRegistries"` // docker.io stands for Docker Hub
+	RequiredLabels     []string `yaml:"requiredLabels"`
+
+	DefaultMemory    int64             `yaml:"defaultMemory"` // bytes, set when no limit is requested
+	DefaultCPUs      float64           `yaml:"defaultCPUs"`   // set when no limit is requested
+	DefaultLabels    map[string]string `yaml:"defaultLabels"` // added unless already set
+	DropCapabilities []string          `yaml:"dropCapabilities"`
+}
+
+// PolicyViolation is the error returned when a request breaks a policy rule
+type PolicyViolation struct {
+	Rule   string
+	Reason string
+}
+
+func (v *PolicyViolation) Error() string {
+	return fmt.Sprintf("policy rule %s violated: %s", v.Rule, v.Reason)
+}
+
+// LoadPolicy reads a policy from a YAML or JSON file. Unknown fields are
+// rejected so that a misspelled rule does not go unnoticed
+func LoadPolicy(name string) (*Policy, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+
+	var p Policy
+	if err = dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("policy %s: %w", name, err)
+	}
+
+	return &p, nil
+}
+
+// SetPolicy sets the admission policy, nil disables it
+func (a *API) SetPolicy(p *Policy) {
+	a.policy = p
+}
+
+// policyLookup resolves the volumes, containers and images a request refers
+// to, *docker.Client implements it
+type policyLookup interface {
+	InspectVolume(name string) (*docker.Volume, error)
+	InspectContainerWithOptions(opts docker.InspectContainerOptions) (*docker.Container, error)
+	InspectImage(name string) (*docker.Image, error)
+}
+
+// AdmitCreate applies the policy to a container create request, mutating it.
+// Named volumes, VolumesFrom and the image are resolved through lookup
+func (p *Policy) AdmitCreate(c *docker.CreateContainerOptions, lookup policyLookup) error {
+	if p == nil {
+		return nil
+	}
+
+	if c.Config == nil {
+		c.Config = &docker.Config{}
+	}
+	if c.HostConfig == nil {
+		c.HostConfig = &docker.HostConfig{}
+	}
+
+	p.mutateCreate(c)
+
+	hc := c.HostConfig
+
+	if p.DenyPrivileged && hc.Privileged {
+		return &PolicyViolation{Rule: "denyPrivileged", Reason: "privileged containers are not allowed"}
+	}
+
+	namespaces := []struct {
+		deny   bool
+		rule   string
+		reason string
+		mode   func(*docker.HostConfig) string
+	}{
+		{p.DenyHostNetwork, "denyHostNetwork", "the host network is not allowed",
+			func(hc *docker.HostConfig) string { return hc.NetworkMode }},
+		{p.DenyHostPID, "denyHostPID", "the host PID namespace is not allowed",
+			func(hc *docker.HostConfig) string { return hc.PidMode }},
+		{p.DenyHostIPC, "denyHostIPC", "the host IPC namespace is not allowed",
+			func(hc *docker.HostConfig) string { return hc.IpcMode }},
+	}
+
+	for _, ns := range namespaces {
+		if !ns.deny {
+			continue
+		}
+
+		mode, err := namespaceMode(ns.mode(hc), ns.mode, lookup)
+		if err != nil {
+			return err
+		}
+
+		if mode == "host" {
+			return &PolicyViolation{Rule: ns.rule, Reason: ns.reason}
+		}
+	}
+
+	sources, err := bindSources(hc, lookup)
+	if err != nil {
+		return err
+	}
+
+	for _, src := range sources {
+		if err = p.checkBindSource(src); err != nil {
+			return err
+		}
+	}
+
+	if err = p.checkCapabilities(hc.CapAdd); err != nil {
+		return err
+	}
+
+	if err = p.checkMemory(hc.Memory, true); err != nil {
+		return err
+	}
+
+	if err = p.checkCPUs(hostConfigCPUs(hc), true); err != nil {
+		return err
+	}
+
+	if err = p.checkRegistry(c.Config.Image, lookup); err != nil {
+		return err
+	}
+
+	for _, label := range p.RequiredLabels {
+		if _, ok := c.Config.Labels[label]; !ok {
+			return &PolicyViolation{Rule: "requiredLabels", Reason: "label " + label + " is required"}
+		}
+	}
+
+	return nil
+}
+
+// mutateCreate applies the defaults of the policy to a create request
+func (p *Policy) mutateCreate(c *docker.CreateContainerOptions) {
+	hc := c.HostConfig
+
+	if p.DefaultMemory > 0 && hc.Memory == 0 {
+		hc.Memory = p.DefaultMemory
+	}
+
+	if p.DefaultCPUs > 0 && hostConfigCPUs(hc) == 0 {
+		hc.NanoCPUs = int64(p.DefaultCPUs * 1e9)
+	}
+
+	if len(p.DefaultLabels) > 0 && c.Config.Labels == nil {
+		c.Config.Labels = make(map[string]string)
+	}
+
+	for k, v := range p.DefaultLabels {
+		if _, ok := c.Config.Labels[k]; !ok {
+			c.Config.Labels[k] = v
+		}
+	}
+
+	for _, capability := range p.DropCapabilities {
+		if !slices.ContainsFunc(hc.CapDrop, func(c string) bool { return sameCapability(c, capability) }) {
+			hc.CapDrop = append(hc.CapDrop, capability)
+		}
+	}
+}
+
+// AdmitVolume applies the policy to a volume create request. Volumes of the
+// local driver with the bind option are bind mounts of their device
+func (p *Policy) AdmitVolume(c *docker.CreateVolumeOptions) error {
+	if p == nil {
+		return nil
+	}
+
+	if src, ok := volumeBindSource(c.DriverOpts); ok {
+		return p.checkBindSource(src)
+	}
+
+	return nil
+}
+
+// AdmitUpdate applies the policy to a container update request. Limits left
+// out of the request are not changed and thus not checked
+func (p *Policy) AdmitUpdate(c *docker.UpdateContainerOptions) error {
+	if p == nil {
+		return nil
+	}
+
+	if err := p.checkMemory(int64(c.Memory), false); err != nil {
+		return err
+	}
+
+	// a negative quota lifts the CPU limit
+	if c.CPUQuota < 0 {
+		return p.checkCPUs(0, true)
+	}
+
+	return p.checkCPUs(quotaCPUs(int64(c.CPUQuota), int64(c.CPUPeriod)), false)
+}
+
+// AdmitExec applies the policy to an exec create request
+func (p *Policy) AdmitExec(c *docker.CreateExecOptions) error {
+	if p == nil {
+		return nil
+	}
+
+	if p.DenyPrivileged && c.Privileged {
+		return &PolicyViolation{Rule: "denyPrivileged", Reason: "privileged exec sessions are not allowed"}
+	}
+
+	return nil
+}
+
+func (p *Policy) checkBindSource(src string) error {
+	src = path.Clean(src)
+
+	for _, denied := range p.DeniedBindSources {
+		if src == path.Clean(denied) {
+			return &PolicyViolation{Rule: "deniedBindSources", Reason: "bind mounting " + src + " is not allowed"}
+		}
+	}
+
+	if hasPathPrefix(src, p.DeniedBindPrefixes) {
+		return &PolicyViolation{Rule: "deniedBindPrefixes", Reason: "bind mounting " + src + " is not allowed"}
+	}
+
+	return nil
+}
+
+// checkRegistry ties an image to the allowed registries. A reference naming
+// a repository must be of an allowed registry; an image present locally must
+// also carry a digest of an allowed registry, since local tags can be set to
+// anything. Image IDs of missing images cannot be tied to a registry
+func (p *Policy) checkRegistry(image string, lookup policyLookup) error {
+	if len(p.AllowedRegistries) == 0 {
+		return nil
+	}
+
+	id := isImageID(image)
+	if !id && !p.allowedRegistry(image) {
+		return &PolicyViolation{Rule: "allowedRegistries", Reason: "registry " + policyRegistry(image) + " is not allowed"}
+	}
+
+	img, err := lookup.InspectImage(image)
+	if errors.Is(err, docker.ErrNoSuchImage) {
+		if id {
+			return &PolicyViolation{Rule: "allowedRegistries", Reason: "image " + image + " cannot be tied to a registry"}
+		}
+
+		// pulled from the registry of the reference
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if !slices.ContainsFunc(img.RepoDigests, p.allowedRegistry) {
+		return &PolicyViolation{Rule: "allowedRegistries", Reason: "image " + image + " was not pulled from an allowed registry"}
+	}
+
+	return nil
+}
+
+// allowedRegistry reports whether an image reference is of an allowed registry
+func (p *Policy) allowedRegistry(ref string) bool {
+	return slices.Contains(p.AllowedRegistries, policyRegistry(ref))
+}
+
+// policyRegistry returns the registry of an image reference as named in
+// policies, docker.io for Docker Hub
+func policyRegistry(ref string) string {
+	if registry := imageRegistry(ref); registry != defaultRegistry {
+		return registry
+	}
+
+	return "docker.io"
+}
+
+// isImageID reports whether an image reference is a full or short image ID
+func isImageID(ref string) bool {
+	ref = strings.TrimPrefix(ref, "sha256:")
+	if len(ref) < 12 || len(ref) > 64 {
+		return false
+	}
+
+	return strings.Trim(ref, "0123456789abcdef") == ""
+}
+
+func (p *Policy) checkCapabilities(add []string) error {
+	for _, capability := range add {
+		for _, denied := range p.DeniedCapabilities {
+			if sameCapability(capability, denied) || strings.EqualFold(capability, "ALL") {
+				return &PolicyViolation{Rule: "deniedCapabilities", Reason: "capability " + capability + " is not allowed"}
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkMemory checks a memory limit against the ceiling, 0 meaning unlimited
+// when required is set and unchanged otherwise
+func (p *Policy) checkMemory(memory int64, required bool) error {
+	if p.MaxMemory <= 0 || (memory <= 0 && !required) {
+		return nil
+	}
+
+	if memory <= 0 || memory > p.MaxMemory {
+		return &PolicyViolation{Rule: "maxMemory", Reason: fmt.Sprintf("memory limit must be set and at most %d bytes", p.MaxMemory)}
+	}
+
+	return nil
+}
+
+// checkCPUs checks a CPU limit against the ceiling like checkMemory
+func (p *Policy) checkCPUs(cpus float64, required bool) error {
+	if p.MaxCPUs <= 0 || (cpus <= 0 && !required) {
+		return nil
+	}
+
+	if cpus <= 0 || cpus > p.MaxCPUs {
+		return &PolicyViolation{Rule: "maxCPUs", Reason: fmt.Sprintf("CPU limit must be set and at most %g CPUs", p.MaxCPUs)}
+	}
+
+	return nil
+}
+
+// maxNamespaceJoins bounds the chain of containers followed by namespaceMode
+const maxNamespaceJoins = 16
+
+// namespaceMode resolves a namespace mode joining the namespace of another
+// container, container:<id>, to the mode of that container. mode returns the
+// mode in question of a host config
+func namespaceMode(m string, mode func(*docker.HostConfig) string, lookup policyLookup) (string, error) {
+	for range maxNamespaceJoins {
+		id, ok := strings.CutPrefix(m, "container:")
+		if !ok {
+			return m, nil
+		}
+
+		c, err := lookup.InspectContainerWithOptions(docker.InspectContainerOptions{ID: id})
+		if err != nil {
+			return "", err
+		}
+
+		if c.HostConfig == nil {
+			return "", nil
+		}
+
+		m = mode(c.HostConfig)
+	}
+
+	return "", errors.New("too many joined namespaces: " + m)
+}
+
+// bindSources returns the host paths bind mounted by a host config: bind
+// mounts, volumes of the local driver with the bind option, whether given in
+// the request or created beforehand, and the mounts of VolumesFrom containers
+func bindSources(hc *docker.HostConfig, lookup policyLookup) ([]string, error) {
+	var sources []string
+
+	volume := func(name string, opts map[string]string) error {
+		if src, ok := volumeBindSource(opts); ok {
+			sources = append(sources, src)
+		}
+
+		if name == "" {
+			return nil
+		}
+
+		v, err := lookup.InspectVolume(name)
+		if errors.Is(err, docker.ErrNoSuchVolume) {
+			// created from the request
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if src, ok := volumeBindSource(v.Options); ok {
+			sources = append(sources, src)
+		}
+
+		return nil
+	}
+
+	for _, bind := range hc.Binds {
+		src, _, ok := strings.Cut(bind, ":")
+		if !ok {
+			// an anonymous volume
+			continue
+		}
+
+		if strings.HasPrefix(src, "/") {
+			sources = append(sources, src)
+		} else if err := volume(src, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, m := range hc.Mounts {
+		switch m.Type {
+		case "bind":
+			sources = append(sources, m.Source)
+		case "volume", "":
+			var opts map[string]string
+			if m.VolumeOptions != nil {
+				opts = m.VolumeOptions.DriverConfig.Options
+			}
+
+			if err := volume(m.Source, opts); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, from := range hc.VolumesFrom {
+		id, _, _ := strings.Cut(from, ":")
+
+		c, err := lookup.InspectContainerWithOptions(docker.InspectContainerOptions{ID: id})
+		if err != nil {
+			return nil, err
+		}
+
+		// bind mounts carry no volume name
+		for _, m := range c.Mounts {
+			if m.Name != "" {
+				if err = volume(m.Name, nil); err != nil {
+					return nil, err
+				}
+			} else if m.Source != "" {
+				sources = append(sources, m.Source)
+			}
+		}
+	}
+
+	return sources, nil
+}
+
+// volumeBindSource returns the device of volume driver options that make the
+// local driver bind mount it
+func volumeBindSource(opts map[string]string) (string, bool) {
+	device := opts["device"]
+	if device == "" {
+		return "", false
+	}
+
+	for _, o := range strings.Split(opts["o"], ",") {
+		if o == "bind" || o == "rbind" {
+			return device, true
+		}
+	}
+
+	return "", false
+}
+
+// hostConfigCPUs returns the CPU limit of a host config, 0 when unlimited
+func hostConfigCPUs(hc *docker.HostConfig) float64 {
+	if hc.NanoCPUs > 0 {
+		return float64(hc.NanoCPUs) / 1e9
+	}
+
+	return quotaCPUs(hc.CPUQuota, hc.CPUPeriod)
+}
+
+// quotaCPUs converts a CFS quota to a number of CPUs, 0 when unlimited
+func quotaCPUs(quota, period int64) float64 {
+	if quota <= 0 {
+		return 0
+	}
+
+	if period <= 0 {
+		period = 100000
+	}
+
+	return float64(quota) / float64(period)
+}
+
+// sameCapability compares capability names regardless of case and CAP_ prefix
+func sameCapability(a, b string) bool {
+	trim := func(s string) string {
+		s = strings.ToUpper(s)
+		return strings.TrimPrefix(s, "CAP_")
+	}
+
+	return trim(a) == trim(b)
+}
@@ -0,0 +1,354 @@
+package api
+
+import (
+	"errors"
+	"testing"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// fakeLookup resolves volumes, containers and images from maps
+type fakeLookup struct {
+	volumes    map[string]*docker.Volume
+	containers map[string]*docker.Container
+	images     map[string]*docker.Image
+}
+
+func (l *fakeLookup) InspectVolume(name string) (*docker.Volume, error) {
+	if v, ok := l.volumes[name]; ok {
+		return v, nil
+	}
+
+	return nil, docker.ErrNoSuchVolume
+}
+
+func (l *fakeLookup) InspectContainerWithOptions(opts docker.InspectContainerOptions) (*docker.Container, error) {
+	if c, ok := l.containers[opts.ID]; ok {
+		return c, nil
+	}
+
+	return nil, &docker.NoSuchContainer{ID: opts.ID}
+}
+
+func (l *fakeLookup) InspectImage(name string) (*docker.Image, error) {
+	if img, ok := l.images[name]; ok {
+		return img, nil
+	}
+
+	return nil, docker.ErrNoSuchImage
+}
+
+func newFakeLookup() *fakeLookup {
+	return &fakeLookup{
+		volumes: map[string]*docker.Volume{
+			"plain": {Name: "plain", Driver: "local"},
+			"etc":   {Name: "etc", Driver: "local", Options: map[string]string{"type": "none", "o": "bind", "device": "/etc"}},
+		},
+		containers: map[string]*docker.Container{
+			"with-volume": {ID: "with-volume", Mounts: []docker.Mount{{Name: "etc", Destination: "/data"}}},
+			"with-bind":   {ID: "with-bind", Mounts: []docker.Mount{{Source: "/var/run/docker.sock", Destination: "/sock"}}},
+			"plain":       {ID: "plain", HostConfig: &docker.HostConfig{NetworkMode: "bridge", PidMode: "", IpcMode: "private"}},
+			"host":        {ID: "host", HostConfig: &docker.HostConfig{NetworkMode: "host", PidMode: "host", IpcMode: "host"}},
+			"joined":      {ID: "joined", HostConfig: &docker.HostConfig{NetworkMode: "container:host", PidMode: "container:host", IpcMode: "container:host"}},
+		},
+		images: map[string]*docker.Image{
+			"alpine":                {ID: "sha256:aaaa", RepoDigests: []string{"alpine@sha256:1111"}},
+			"local/app":             {ID: "sha256:bbbb"},
+			"registry.example/app":  {ID: "sha256:cccc", RepoDigests: []string{"registry.example/app@sha256:2222"}},
+			"registry.example/fake": {ID: "sha256:dddd", RepoDigests: []string{"evil.example/fake@sha256:3333"}},
+		},
+	}
+}
+
+func TestAdmitCreate(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+		config *docker.Config
+		host   *docker.HostConfig
+		rule   string // violated rule, empty when admitted
+	}{
+		{
+			name:   "bind source",
+			policy: Policy{DeniedBindSources: []string{"/var/run/docker.sock"}},
+			host:   &docker.HostConfig{Binds: []string{"/var/run/docker.sock:/sock"}},
+			rule:   "deniedBindSources",
+		},
+		{
+			name:   "bind prefix",
+			policy: Policy{DeniedBindPrefixes: []string{"/etc"}},
+			host:   &docker.HostConfig{Binds: []string{"/etc/ssl/../shadow:/shadow:ro"}},
+			rule:   "deniedBindPrefixes",
+		},
+		{
+			name:   "bind outside prefix",
+			policy: Policy{DeniedBindPrefixes: []string{"/etc"}},
+			host:   &docker.HostConfig{Binds: []string{"/etcetera:/data", "anonymous"}},
+		},
+		{
+			name:   "mount",
+			policy: Policy{DeniedBindPrefixes: []string{"/etc"}},
+			host:   &docker.HostConfig{Mounts: []docker.HostMount{{Type: "bind", Source: "/etc", Target: "/etc"}}},
+			rule:   "deniedBindPrefixes",
+		},
+		{
+			name:   "named volume",
+			policy: Policy{DeniedBindPrefixes: []string{"/etc"}},
+			host:   &docker.HostConfig{Binds: []string{"etc:/data"}},
+			rule:   "deniedBindPrefixes",
+		},
+		{
+			name:   "plain named volume",
+			policy: Policy{DeniedBindPrefixes: []string{"/etc"}},
+			host:   &docker.HostConfig{Binds: []string{"plain:/data", "new:/new"}},
+		},
+		{
+			name:   "inline volume options",
+			policy: Policy{DeniedBindPrefixes: []string{"/etc"}},
+			host: &docker.HostConfig{Mounts: []docker.HostMount{{
+				Type:   "volume",
+				Source: "new",
+				Target: "/data",
+				VolumeOptions: &docker.VolumeOptions{DriverConfig: docker.VolumeDriverConfig{
+					Name:    "local",
+					Options: map[string]string{"type": "none", "o": "rbind", "device": "/etc/ssl"},
+				}},
+			}}},
+			rule: "deniedBindPrefixes",
+		},
+		{
+			name:   "volumes from volume",
+			policy: Policy{DeniedBindPrefixes: []string{"/etc"}},
+			host:   &docker.HostConfig{VolumesFrom: []string{"with-volume:ro"}},
+			rule:   "deniedBindPrefixes",
+		},
+		{
+			name:   "volumes from bind",
+			policy: Policy{DeniedBindSources: []string{"/var/run/docker.sock"}},
+			host:   &docker.HostConfig{VolumesFrom: []string{"with-bind"}},
+			rule:   "deniedBindSources",
+		},
+		{
+			name:   "host network",
+			policy: Policy{DenyHostNetwork: true},
+			host:   &docker.HostConfig{NetworkMode: "host"},
+			rule:   "denyHostNetwork",
+		},
+		{
+			name:   "joined host network",
+			policy: Policy{DenyHostNetwork: true},
+			host:   &docker.HostConfig{NetworkMode: "container:joined"},
+			rule:   "denyHostNetwork",
+		},
+		{
+			name:   "joined host PID",
+			policy: Policy{DenyHostPID: true},
+			host:   &docker.HostConfig{PidMode: "container:host"},
+			rule:   "denyHostPID",
+		},
+		{
+			name:   "joined host IPC",
+			policy: Policy{DenyHostIPC: true},
+			host:   &docker.HostConfig{IpcMode: "container:joined"},
+			rule:   "denyHostIPC",
+		},
+		{
+			name:   "joined private namespaces",
+			policy: Policy{DenyHostNetwork: true, DenyHostPID: true, DenyHostIPC: true},
+			host:   &docker.HostConfig{NetworkMode: "container:plain", PidMode: "container:plain", IpcMode: "container:plain"},
+		},
+		{
+			name:   "registry",
+			policy: Policy{AllowedRegistries: []string{"registry.example"}},
+			config: &docker.Config{Image: "evil.example/app"},
+			rule:   "allowedRegistries",
+		},
+		{
+			name:   "registry by digest",
+			policy: Policy{AllowedRegistries: []string{"registry.example"}},
+			config: &docker.Config{Image: "registry.example/app"},
+		},
+		{
+			name:   "retagged image",
+			policy: Policy{AllowedRegistries: []string{"registry.example"}},
+			config: &docker.Config{Image: "registry.example/fake"},
+			rule:   "allowedRegistries",
+		},
+		{
+			name:   "image to pull",
+			policy: Policy{AllowedRegistries: []string{"registry.example"}},
+			config: &docker.Config{Image: "registry.example/new:1.0"},
+		},
+		{
+			name:   "docker hub",
+			policy: Policy{AllowedRegistries: []string{"docker.io"}},
+			config: &docker.Config{Image: "alpine"},
+		},
+		{
+			name:   "missing image ID",
+			policy: Policy{AllowedRegistries: []string{"docker.io"}},
+			config: &docker.Config{Image: "0123456789ab"},
+			rule:   "allowedRegistries",
+		},
+		{
+			name:   "memory unset",
+			policy: Policy{MaxMemory: 1 << 30},
+			host:   &docker.HostConfig{},
+			rule:   "maxMemory",
+		},
+		{
+			name:   "memory too high",
+			policy: Policy{MaxMemory: 1 << 30},
+			host:   &docker.HostConfig{Memory: 2 << 30},
+			rule:   "maxMemory",
+		},
+		{
+			name:   "memory default",
+			policy: Policy{MaxMemory: 1 << 30, DefaultMemory: 512 << 20},
+			host:   &docker.HostConfig{},
+		},
+		{
+			name:   "CPUs unset",
+			policy: Policy{MaxCPUs: 2},
+			host:   &docker.HostConfig{},
+			rule:   "maxCPUs",
+		},
+		{
+			name:   "CPUs too high",
+			policy: Policy{MaxCPUs: 2},
+			host:   &docker.HostConfig{NanoCPUs: 3e9},
+			rule:   "maxCPUs",
+		},
+		{
+			name:   "CPU quota",
+			policy: Policy{MaxCPUs: 2},
+			host:   &docker.HostConfig{CPUQuota: 150000, CPUPeriod: 100000},
+		},
+		{
+			name:   "CPU quota too high",
+			policy: Policy{MaxCPUs: 2},
+			host:   &docker.HostConfig{CPUQuota: 300000},
+			rule:   "maxCPUs",
+		},
+	}
+
+	lookup := newFakeLookup()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			if config == nil {
+				config = &docker.Config{Image: "alpine"}
+			}
+
+			err := tt.policy.AdmitCreate(&docker.CreateContainerOptions{Config: config, HostConfig: tt.host}, lookup)
+
+			var violation *PolicyViolation
+			switch {
+			case tt.rule == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.rule != "" && !errors.As(err, &violation):
+				t.Fatalf("expected a %s violation, got %v", tt.rule, err)
+			case tt.rule != "" && violation.Rule != tt.rule:
+				t.Fatalf("expected a %s violation, got %v", tt.rule, violation)
+			}
+		})
+	}
+}
+
+func TestAdmitCreateMissingContainer(t *testing.T) {
+	p := Policy{DenyHostNetwork: true}
+
+	err := p.AdmitCreate(&docker.CreateContainerOptions{
+		HostConfig: &docker.HostConfig{NetworkMode: "container:missing"},
+	}, newFakeLookup())
+
+	var noContainer *docker.NoSuchContainer
+	if !errors.As(err, &noContainer) {
+		t.Fatalf("expected a missing container error, got %v", err)
+	}
+}
+
+func TestAdmitCreateDefaults(t *testing.T) {
+	p := Policy{
+		DefaultMemory:    512 << 20,
+		DefaultCPUs:      1.5,
+		DefaultLabels:    map[string]string{"team": "default", "env": "dev"},
+		DropCapabilities: []string{"NET_RAW"},
+	}
+
+	c := docker.CreateContainerOptions{
+		Config:     &docker.Config{Image: "alpine", Labels: map[string]string{"team": "ops"}},
+		HostConfig: &docker.HostConfig{CapDrop: []string{"cap_net_raw"}},
+	}
+
+	if err := p.AdmitCreate(&c, newFakeLookup()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if c.HostConfig.Memory != 512<<20 {
+		t.Errorf("memory = %d, want %d", c.HostConfig.Memory, 512<<20)
+	}
+
+	if c.HostConfig.NanoCPUs != 1.5e9 {
+		t.Errorf("nano CPUs = %d, want %d", c.HostConfig.NanoCPUs, int64(1.5e9))
+	}
+
+	if c.Config.Labels["team"] != "ops" || c.Config.Labels["env"] != "dev" {
+		t.Errorf("labels = %v", c.Config.Labels)
+	}
+
+	if len(c.HostConfig.CapDrop) != 1 {
+		t.Errorf("dropped capabilities = %v", c.HostConfig.CapDrop)
+	}
+}
+
+func TestAdmitUpdate(t *testing.T) {
+	p := Policy{MaxMemory: 1 << 30, MaxCPUs: 2}
+
+	tests := []struct {
+		name string
+		opts docker.UpdateContainerOptions
+		rule string
+	}{
+		{name: "unchanged", opts: docker.UpdateContainerOptions{}},
+		{name: "memory", opts: docker.UpdateContainerOptions{Memory: 512 << 20}},
+		{name: "memory too high", opts: docker.UpdateContainerOptions{Memory: 2 << 30}, rule: "maxMemory"},
+		{name: "CPU quota", opts: docker.UpdateContainerOptions{CPUQuota: 200000}},
+		{name: "CPU quota too high", opts: docker.UpdateContainerOptions{CPUQuota: 50000, CPUPeriod: 10000}, rule: "maxCPUs"},
+		{name: "CPU limit lifted", opts: docker.UpdateContainerOptions{CPUQuota: -1}, rule: "maxCPUs"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.AdmitUpdate(&tt.opts)
+
+			var violation *PolicyViolation
+			switch {
+			case tt.rule == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.rule != "" && (!errors.As(err, &violation) || violation.Rule != tt.rule):
+				t.Fatalf("expected a %s violation, got %v", tt.rule, err)
+			}
+		})
+	}
+}
+
+func TestAdmitVolume(t *testing.T) {
+	p := Policy{DeniedBindPrefixes: []string{"/etc"}}
+
+	err := p.AdmitVolume(&docker.CreateVolumeOptions{
+		Name:       "etc",
+		Driver:     "local",
+		DriverOpts: map[string]string{"type": "none", "o": "bind", "device": "/etc"},
+	})
+
+	var violation *PolicyViolation
+	if !errors.As(err, &violation) || violation.Rule != "deniedBindPrefixes" {
+		t.Fatalf("expected a deniedBindPrefixes violation, got %v", err)
+	}
+
+	if err = p.AdmitVolume(&docker.CreateVolumeOptions{Name: "plain"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
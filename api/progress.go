@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+)
+
+// ProgressMessage is a progress message reported by the docker daemon while
+// pulling, pushing, building or loading images
+type ProgressMessage struct {
+	ID             string `json:",omitempty"`
+	Status         string `json:",omitempty"`
+	Stream         string `json:",omitempty"`
+	Progress       string `json:",omitempty"`
+	ProgressDetail *struct {
+		Current int64 `json:",omitempty"`
+		Total   int64 `json:",omitempty"`
+	} `json:",omitempty"`
+	Aux         json.RawMessage `json:",omitempty"`
+	Error       string          `json:",omitempty"`
+	ErrorDetail *struct {
+		Code    int    `json:",omitempty"`
+		Message string `json:",omitempty"`
+	} `json:",omitempty"`
+}
+
+// progressError is an error reported inside a progress stream, with the
+// status code the daemon gives it when known
+type progressError struct {
+	code int
+	msg  string
+}
+
+func (e *progressError) Error() string {
+	return e.msg
+}
+
+// progressWriter decodes the JSON message stream written by the daemon and
+// passes every message to fn. The daemon reports failures inside the stream,
+// so the first error message is kept and returned by Err
+type progressWriter struct {
+	lineWriter
+	err error
+}
+
+func newProgressWriter(fn func(m ProgressMessage) error) *progressWriter {
+	pw := &progressWriter{}
+	pw.fn = func(line []byte) error {
+		if len(line) == 0 {
+			return nil
+		}
+
+		var m ProgressMessage
+		if err := json.Unmarshal(line, &m); err != nil {
+			m = ProgressMessage{Stream: string(line)}
+		}
+
+		if m.Error != "" && pw.err == nil {
+			pe := &progressError{msg: m.Error}
+			if m.ErrorDetail != nil {
+				pe.code = m.ErrorDetail.Code
+			}
+
+			pw.err = pe
+		}
+
+		return fn(m)
+	}
+
+	return pw
+}
+
+// Err flushes the writer and returns the first error reported by the daemon
+func (pw *progressWriter) Err() error {
+	if err := pw.Flush(); err != nil {
+		return err
+	}
+
+	return pw.err
+}
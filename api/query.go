@@ -0,0 +1,135 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// queryBool parses a boolean query parameter, returning def when it is absent
+func queryBool(r *http.Request, name string, def bool) (bool, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s parameter: %q", name, v)
+	}
+
+	return b, nil
+}
+
+// queryTime parses a time query parameter given as unix seconds, RFC 3339 or
+// a duration relative to now (e.g. "10m"), returning the zero time when it is absent
+func queryTime(r *http.Request, name string) (time.Time, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return time.Time{}, nil
+	}
+
+	if sec, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+
+	if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+		return t, nil
+	}
+
+	if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+		return time.Now().Add(-d), nil
+	}
+
+	return time.Time{}, fmt.Errorf("invalid %s parameter: %q", name, v)
+}
+
+// queryDuration parses a duration query parameter given as seconds or as a
+// Go duration (e.g. "90s"), returning def when it is absent
+func queryDuration(r *http.Request, name string, def time.Duration) (time.Duration, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+
+	if sec, err := strconv.Atoi(v); err == nil && sec >= 0 {
+		return time.Duration(sec) * time.Second, nil
+	}
+
+	if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+		return d, nil
+	}
+
+	return 0, fmt.Errorf("invalid %s parameter: %q", name, v)
+}
+
+// queryInt parses a non-negative integer query parameter, returning def when it is absent
+func queryInt(r *http.Request, name string, def int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s parameter: %q", name, v)
+	}
+
+	return n, nil
+}
+
+// queryFilters builds docker filters from the query parameters listed in names
+func queryFilters(r *http.Request, names ...string) map[string][]string {
+	filters := make(map[string][]string)
+
+	for _, name := range names {
+		if values := r.URL.Query()[name]; len(values) > 0 {
+			filters[name] = values
+		}
+	}
+
+	return filters
+}
+
+// querySort parses the sort and order query parameters. The sort field must
+// be one of fields; order is asc or desc and defaults to desc
+func querySort(r *http.Request, fields ...string) (field string, desc bool, err error) {
+	field = r.URL.Query().Get("sort")
+	if field != "" && !slices.Contains(fields, field) {
+		return "", false, fmt.Errorf("invalid sort parameter: %q", field)
+	}
+
+	switch order := r.URL.Query().Get("order"); order {
+	case "", "desc":
+		return field, true, nil
+	case "asc":
+		return field, false, nil
+	default:
+		return "", false, fmt.Errorf("invalid order parameter: %q", order)
+	}
+}
+
+// paginate applies the limit and offset query parameters to items and
+// reports the number of items before pagination in the X-Total-Count header
+func paginate[T any](w http.ResponseWriter, r *http.Request, items []T) ([]T, error) {
+	limit, err := queryInt(r, "limit", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(items)))
+
+	items = items[min(offset, len(items)):]
+	if limit > 0 {
+		items = items[:min(limit, len(items))]
+	}
+
+	return items, nil
+}
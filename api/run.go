@@ -0,0 +1,243 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// maxRunTimeout bounds how long a run request may keep its container running
+const maxRunTimeout = time.Hour
+
+// maxRunOutput bounds the output captured of each stream, the rest is dropped
+const maxRunOutput = 1 << 20
+
+// RunResult is the outcome of a run
+type RunResult struct {
+	ID          string
+	ExitCode    int
+	Stdout      string
+	Stderr      string
+	TimedOut    bool        `json:",omitempty"`
+	Truncated   bool        `json:",omitempty"` // output past maxRunOutput was dropped
+	Removed     bool        `json:",omitempty"`
+	RemoveError string      `json:",omitempty"`
+	Pull        *PullResult `json:",omitempty"`
+}
+
+// RunContainer creates a container from the same body and pull parameters as
+// CreateContainer, starts it, waits for it to exit and returns its exit code
+// with the captured stdout and stderr. The container is killed once the
+// timeout parameter (five minutes by default, an hour at most) runs out, in
+// which case 408 is returned. Each stream keeps its first MiB of output. With
+// rm=true the container is removed before the result is returned
+func (a *API) RunContainer(w http.ResponseWriter, r *http.Request) {
+	var c docker.CreateContainerOptions
+
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	remove, err := queryBool(r, "rm", false)
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	timeout, err := queryDuration(r, "timeout", 5*time.Minute)
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	pulled, ok := a.prepareCreate(w, r, &c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	c.Context = ctx
+
+	create, err := a.client.CreateContainer(c)
+	if err != nil {
+		if errors.Is(err, docker.ErrNoSuchImage) {
+			writeError(w, err, kindImage, c.Config.Image)
+			return
+		}
+
+		writeError(w, err, kindContainer, c.Name)
+		return
+	}
+
+	result := RunResult{ID: create.ID, Pull: pulled}
+
+	removeContainer := func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		return a.client.RemoveContainer(docker.RemoveContainerOptions{
+			ID:            create.ID,
+			RemoveVolumes: true,
+			Force:         true,
+			Context:       ctx,
+		})
+	}
+
+	// runs that fail before the result is written are cleaned up too
+	cleanup := remove
+	defer func() {
+		if !cleanup {
+			return
+		}
+
+		if err := removeContainer(); err != nil {
+			a.logger.Error(err)
+		}
+	}()
+
+	// attach before starting, so that no output is lost
+	stdout := &lockedBuffer{limit: maxRunOutput}
+	stderr := &lockedBuffer{limit: maxRunOutput}
+	success := make(chan struct{})
+	attach, err := a.client.AttachToContainerNonBlocking(docker.AttachToContainerOptions{
+		Container:    create.ID,
+		OutputStream: stdout,
+		ErrorStream:  stderr,
+		RawTerminal:  c.Config != nil && c.Config.Tty,
+		Success:      success,
+		Stream:       true,
+		Stdout:       true,
+		Stderr:       true,
+	})
+	if err != nil {
+		writeError(w, err, kindContainer, create.ID)
+		return
+	}
+
+	cw := &closeOnce{CloseWaiter: attach}
+	defer cw.Close()
+
+	<-success
+	success <- struct{}{}
+
+	if err = a.client.StartContainerWithContext(create.ID, nil, ctx); err != nil {
+		writeError(w, err, kindContainer, create.ID)
+		return
+	}
+
+	runCtx, runCancel := context.WithTimeout(r.Context(), min(timeout, maxRunTimeout))
+	defer runCancel()
+
+	result.ExitCode, err = a.client.WaitContainerWithContext(create.ID, runCtx)
+	if err != nil {
+		if runCtx.Err() == nil {
+			writeError(w, err, kindContainer, create.ID)
+			return
+		}
+
+		result.TimedOut = true
+
+		if err = a.client.KillContainer(docker.KillContainerOptions{ID: create.ID}); err != nil {
+			a.logger.Error(err)
+		}
+
+		if r.Context().Err() != nil {
+			return
+		}
+
+		ctx, cancel = context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		if result.ExitCode, err = a.client.WaitContainerWithContext(create.ID, ctx); err != nil {
+			a.logger.Error(err)
+		}
+	}
+
+	// the attach ends with the container, give it a moment to drain
+	ctx, cancel = context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	_ = waitOrClose(ctx, cw)
+
+	result.Stdout = stdout.String()
+	result.Stderr = stderr.String()
+	result.Truncated = stdout.Truncated() || stderr.Truncated()
+
+	if remove {
+		cleanup = false
+
+		if err = removeContainer(); err != nil {
+			a.logger.Error(err)
+			result.RemoveError = err.Error()
+		} else {
+			result.Removed = true
+		}
+	}
+
+	if result.TimedOut {
+		write(w, http.StatusRequestTimeout, result)
+		return
+	}
+
+	write(w, http.StatusOK, result)
+}
+
+// lockedBuffer is a bytes.Buffer safe for concurrent use. Writes past limit
+// are dropped, still reporting success so that the writer keeps draining
+type lockedBuffer struct {
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if room := b.limit - b.buf.Len(); len(p) > room {
+		b.truncated = true
+		b.buf.Write(p[:max(room, 0)])
+		return len(p), nil
+	}
+
+	return b.buf.Write(p)
+}
+
+// Truncated reports whether writes were dropped
+func (b *lockedBuffer) Truncated() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.truncated
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
+
+// closeOnce makes closing a hijacked session safe to repeat
+type closeOnce struct {
+	docker.CloseWaiter
+	once sync.Once
+}
+
+func (c *closeOnce) Close() error {
+	c.once.Do(func() {
+		_ = c.CloseWaiter.Close()
+	})
+
+	return nil
+}
@@ -0,0 +1,223 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/go-chi/chi/v5"
+)
+
+// ContainerStats is a resource usage sample of a container. CPU usage is
+// computed from the reading against the previous CPU figures the daemon
+// includes in it; the I/O deltas cover the time since the previous reading
+// and are zero for the first one
+type ContainerStats struct {
+	Read            time.Time
+	Interval        float64 // seconds covered by the CPU figures
+	CPUPercent      float64
+	OnlineCPUs      uint64
+	MemoryUsage     uint64
+	MemoryLimit     uint64
+	MemoryPercent   float64
+	NetworkRx       uint64
+	NetworkTx       uint64
+	NetworkRxDelta  uint64
+	NetworkTxDelta  uint64
+	BlockRead       uint64
+	BlockWrite      uint64
+	BlockReadDelta  uint64
+	BlockWriteDelta uint64
+	PIDs            uint64
+}
+
+// ContainerStats returns the resource usage of a container. By default a
+// single sample is returned; stream=true streams a sample per second as SSE
+// or NDJSON until the client disconnects
+func (a *API) ContainerStats(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	streaming, err := queryBool(r, "stream", false)
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if streaming {
+		ctx, cancel = context.WithCancel(r.Context())
+	} else {
+		ctx, cancel = context.WithTimeout(r.Context(), 10*time.Second)
+	}
+	defer cancel()
+
+	statsC := make(chan *docker.Stats)
+	errC := make(chan error, 1)
+	// a single reading of the daemon already carries the previous CPU figures
+	go func() {
+		errC <- a.client.Stats(docker.StatsOptions{
+			ID:      id,
+			Stats:   statsC,
+			Stream:  streaming,
+			Context: ctx,
+		})
+	}()
+
+	stream := newEventStream(w, r)
+	defer stream.Close()
+
+	var prev *docker.Stats
+	var result *ContainerStats
+	for s := range statsC {
+		st := computeStats(prev, s)
+
+		if !streaming {
+			result = &st
+			break
+		}
+
+		if err = stream.Send("stats", st); err != nil {
+			break
+		}
+
+		prev = s
+	}
+
+	cancel()
+	go func() {
+		for range statsC {
+		}
+	}()
+
+	err = <-errC
+
+	if result != nil {
+		write(w, http.StatusOK, result)
+		return
+	}
+
+	if r.Context().Err() != nil {
+		return
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		stream.Error(ctx.Err(), kindContainer, id)
+		return
+	}
+
+	if err == nil {
+		if !streaming {
+			stream.Error(errors.New("stats stream ended before a sample was read"), kindContainer, id)
+		}
+		return
+	}
+
+	stream.Error(err, kindContainer, id)
+}
+
+// computeStats computes a usage sample the same way the docker CLI does. prev
+// is the previous reading, nil for the first one
+func computeStats(prev, cur *docker.Stats) ContainerStats {
+	st := ContainerStats{
+		Read:        cur.Read,
+		OnlineCPUs:  cur.CPUStats.OnlineCPUs,
+		MemoryUsage: memoryUsage(cur),
+		MemoryLimit: cur.MemoryStats.Limit,
+		PIDs:        cur.PidsStats.Current,
+	}
+
+	if st.OnlineCPUs == 0 {
+		st.OnlineCPUs = uint64(len(cur.CPUStats.CPUUsage.PercpuUsage))
+	}
+
+	if !cur.PreRead.IsZero() {
+		st.Interval = cur.Read.Sub(cur.PreRead).Seconds()
+	}
+
+	// the first reading of a stream has no previous CPU figures
+	pre := cur.PreCPUStats
+	cpuDelta := float64(cur.CPUStats.CPUUsage.TotalUsage) - float64(pre.CPUUsage.TotalUsage)
+	systemDelta := float64(cur.CPUStats.SystemCPUUsage) - float64(pre.SystemCPUUsage)
+	if pre.SystemCPUUsage > 0 && cpuDelta > 0 && systemDelta > 0 {
+		st.CPUPercent = cpuDelta / systemDelta * float64(st.OnlineCPUs) * 100
+	}
+
+	if st.MemoryLimit > 0 {
+		st.MemoryPercent = float64(st.MemoryUsage) / float64(st.MemoryLimit) * 100
+	}
+
+	st.NetworkRx, st.NetworkTx = networkIO(cur)
+	st.BlockRead, st.BlockWrite = blockIO(cur)
+
+	if prev == nil {
+		return st
+	}
+
+	prevRx, prevTx := networkIO(prev)
+	st.NetworkRxDelta = counterDelta(prevRx, st.NetworkRx)
+	st.NetworkTxDelta = counterDelta(prevTx, st.NetworkTx)
+
+	prevRead, prevWrite := blockIO(prev)
+	st.BlockReadDelta = counterDelta(prevRead, st.BlockRead)
+	st.BlockWriteDelta = counterDelta(prevWrite, st.BlockWrite)
+
+	return st
+}
+
+// memoryUsage returns the memory usage without the page cache
+func memoryUsage(s *docker.Stats) uint64 {
+	usage := s.MemoryStats.Usage
+
+	// cgroup v1
+	if v := s.MemoryStats.Stats.TotalInactiveFile; v > 0 && v < usage {
+		return usage - v
+	}
+
+	// cgroup v2
+	if v := s.MemoryStats.Stats.InactiveFile; v < usage {
+		return usage - v
+	}
+
+	return usage
+}
+
+// networkIO returns the bytes received and sent over all interfaces
+func networkIO(s *docker.Stats) (rx, tx uint64) {
+	if len(s.Networks) == 0 {
+		return s.Network.RxBytes, s.Network.TxBytes
+	}
+
+	for _, n := range s.Networks {
+		rx += n.RxBytes
+		tx += n.TxBytes
+	}
+
+	return rx, tx
+}
+
+// blockIO returns the bytes read from and written to block devices
+func blockIO(s *docker.Stats) (rd, wr uint64) {
+	for _, e := range s.BlkioStats.IOServiceBytesRecursive {
+		switch strings.ToLower(e.Op) {
+		case "read":
+			rd += e.Value
+		case "write":
+			wr += e.Value
+		}
+	}
+
+	return rd, wr
+}
+
+// counterDelta returns the growth of a counter, treating a reset as a restart from zero
+func counterDelta(prev, cur uint64) uint64 {
+	if cur < prev {
+		return cur
+	}
+
+	return cur - prev
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// errStreamClosed is returned by eventStream.Send once the stream is closed
+var errStreamClosed = errors.New("stream closed")
+
+// eventStream writes a sequence of JSON events to the client as either
+// Server-Sent Events or newline delimited JSON, flushing after every event.
+// The response headers are only written with the first event, so errors that
+// happen before anything was sent can still be reported with write.
+type eventStream struct {
+	mu      sync.Mutex
+	w       http.ResponseWriter
+	flusher http.Flusher
+	sse     bool
+	started bool
+	closed  bool
+}
+
+// newEventStream creates an event stream, choosing SSE when the client asks
+// for it with ?format=sse or an Accept: text/event-stream header
+func newEventStream(w http.ResponseWriter, r *http.Request) *eventStream {
+	sse := r.URL.Query().Get("format") == "sse" ||
+		strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+
+	flusher, _ := w.(http.Flusher)
+
+	return &eventStream{w: w, flusher: flusher, sse: sse}
+}
+
+// Started reports whether the response headers have already been sent
+func (s *eventStream) Started() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.started
+}
+
+// Send writes a single event with the given name and data
+func (s *eventStream) Send(event string, data interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return errStreamClosed
+	}
+
+	s.start()
+
+	var buf bytes.Buffer
+	if s.sse {
+		buf.WriteString("event: " + event + "\n")
+		buf.WriteString("data: ")
+		buf.Write(b)
+		buf.WriteString("\n\n")
+	} else {
+		buf.Write(b)
+		buf.WriteByte('\n')
+	}
+
+	if _, err = s.w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+
+	return nil
+}
+
+// Open sends the response headers right away, for streams that may stay
+// silent for a while
+func (s *eventStream) Open() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return errStreamClosed
+	}
+
+	s.start()
+
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+
+	return nil
+}
+
+// start writes the response headers unless they were already sent. s.mu must be held
+func (s *eventStream) start() {
+	if s.started {
+		return
+	}
+
+	s.started = true
+
+	if s.sse {
+		s.w.Header().Set("Content-Type", "text/event-stream")
+	} else {
+		s.w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	s.w.Header().Set("Cache-Control", "no-cache")
+	s.w.Header().Set("X-Accel-Buffering", "no")
+	s.w.WriteHeader(http.StatusOK)
+}
+
+// Close makes every later Send fail, so goroutines that outlive the handler
+// never touch the response writer
+func (s *eventStream) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+}
+
+// Error reports err about the resource of the given kind and id, either as a
+// regular error response when nothing was streamed yet or as a final "error"
+// event otherwise
+func (s *eventStream) Error(err error, kind, id string) {
+	status, resp := errorResponse(err, kind, id)
+
+	if !s.Started() {
+		write(s.w, status, resp)
+		return
+	}
+
+	_ = s.Send("error", resp)
+}
+
+// lineWriter splits everything written to it into lines and passes each
+// complete line, without the trailing newline, to fn
+type lineWriter struct {
+	buf []byte
+	fn  func(line []byte) error
+}
+
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	lw.buf = append(lw.buf, p...)
+
+	for {
+		i := bytes.IndexByte(lw.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		line := bytes.TrimSuffix(lw.buf[:i], []byte("\r"))
+		lw.buf = lw.buf[i+1:]
+
+		if err := lw.fn(line); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+// Flush passes any incomplete trailing line to fn
+func (lw *lineWriter) Flush() error {
+	if len(lw.buf) == 0 {
+		return nil
+	}
+
+	line := lw.buf
+	lw.buf = nil
+
+	return lw.fn(line)
+}
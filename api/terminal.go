@@ -0,0 +1,310 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+}
+
+// Terminal output channels, sent as the first byte of every binary message
+const (
+	terminalStdout byte = 1
+	terminalStderr byte = 2
+)
+
+// TerminalMessage is a control message exchanged as a WebSocket text message.
+// Clients send "stdin" and "resize" messages, the server sends "exit" and "error"
+type TerminalMessage struct {
+	Type     string
+	Data     string `json:",omitempty"`
+	Height   int    `json:",omitempty"`
+	Width    int    `json:",omitempty"`
+	ExitCode int    `json:",omitempty"`
+	Error    string `json:",omitempty"`
+}
+
+// terminal bridges a WebSocket connection to a hijacked docker session.
+// Binary messages from the client are written to stdin as is; output is sent
+// as binary messages prefixed with the channel byte
+type terminal struct {
+	mu     sync.Mutex
+	conn   *websocket.Conn
+	ctx    context.Context
+	cancel context.CancelFunc
+	stdin  *io.PipeReader
+	resize func(height, width int) error
+}
+
+// newTerminal upgrades the request to a WebSocket connection and starts
+// reading client messages. Stdin messages are dropped unless stdin is set.
+// The terminal context is canceled once the client goes away
+func newTerminal(w http.ResponseWriter, r *http.Request, stdin bool, resize func(height, width int) error) (*terminal, error) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	pr, pw := io.Pipe()
+
+	t := &terminal{conn: conn, ctx: ctx, cancel: cancel, stdin: pr, resize: resize}
+
+	go func() {
+		defer cancel()
+		defer pw.Close()
+
+		for {
+			kind, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			if kind == websocket.BinaryMessage {
+				if !stdin {
+					continue
+				}
+
+				if _, err = pw.Write(data); err != nil {
+					return
+				}
+				continue
+			}
+
+			var m TerminalMessage
+			if err = json.Unmarshal(data, &m); err != nil {
+				_ = t.Send(TerminalMessage{Type: "error", Error: err.Error()})
+				continue
+			}
+
+			switch m.Type {
+			case "stdin":
+				if !stdin {
+					continue
+				}
+
+				if _, err = pw.Write([]byte(m.Data)); err != nil {
+					return
+				}
+			case "resize":
+				if err = t.resize(m.Height, m.Width); err != nil {
+					_ = t.Send(TerminalMessage{Type: "error", Error: err.Error()})
+				}
+			default:
+				_ = t.Send(TerminalMessage{Type: "error", Error: "unknown message type: " + m.Type})
+			}
+		}
+	}()
+
+	return t, nil
+}
+
+// Context returns a context that is canceled when the client disconnects
+func (t *terminal) Context() context.Context {
+	return t.ctx
+}
+
+// Stdin returns the reader fed by client stdin messages
+func (t *terminal) Stdin() io.Reader {
+	return t.stdin
+}
+
+// Output returns a writer sending everything written to it on channel ch
+func (t *terminal) Output(ch byte) io.Writer {
+	return terminalWriter{t: t, ch: ch}
+}
+
+// Send sends a control message to the client
+func (t *terminal) Send(m TerminalMessage) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.conn.WriteJSON(m)
+}
+
+// Close sends a close frame and closes the connection
+func (t *terminal) Close() {
+	t.mu.Lock()
+	_ = t.conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	t.mu.Unlock()
+
+	t.cancel()
+	_ = t.conn.Close()
+	_ = t.stdin.Close()
+}
+
+type terminalWriter struct {
+	t  *terminal
+	ch byte
+}
+
+func (tw terminalWriter) Write(p []byte) (int, error) {
+	tw.t.mu.Lock()
+	defer tw.t.mu.Unlock()
+
+	if err := tw.t.conn.WriteMessage(websocket.BinaryMessage, append([]byte{tw.ch}, p...)); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// ExecTerminal opens an interactive exec session in a container over a
+// WebSocket. The command is taken from the cmd query parameters and defaults
+// to /bin/sh; user and workdir are passed to the exec as is
+func (a *API) ExecTerminal(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	tty, err := queryBool(r, "tty", true)
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	cmd := r.URL.Query()["cmd"]
+	if len(cmd) == 0 {
+		cmd = []string{"/bin/sh"}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	exec, err := a.client.CreateExec(docker.CreateExecOptions{
+		Cmd:          cmd,
+		Container:    id,
+		User:         r.URL.Query().Get("user"),
+		WorkingDir:   r.URL.Query().Get("workdir"),
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+		Tty:          tty,
+		Context:      ctx,
+	})
+	if err != nil {
+		writeError(w, err, kindContainer, id)
+		return
+	}
+
+	t, err := newTerminal(w, r, true, func(height, width int) error {
+		return a.client.ResizeExecTTY(exec.ID, height, width)
+	})
+	if err != nil {
+		a.logger.Error(err)
+		return
+	}
+	defer t.Close()
+
+	cw, err := a.client.StartExecNonBlocking(exec.ID, docker.StartExecOptions{
+		InputStream:  t.Stdin(),
+		OutputStream: t.Output(terminalStdout),
+		ErrorStream:  t.Output(terminalStderr),
+		Tty:          tty,
+		RawTerminal:  tty,
+		Context:      t.Context(),
+	})
+	if err != nil {
+		_ = t.Send(TerminalMessage{Type: "error", Error: err.Error()})
+		return
+	}
+
+	if err = waitOrClose(t.Context(), cw); err != nil {
+		_ = t.Send(TerminalMessage{Type: "error", Error: err.Error()})
+		return
+	}
+
+	inspect, err := a.client.InspectExec(exec.ID)
+	if err != nil {
+		_ = t.Send(TerminalMessage{Type: "error", Error: err.Error()})
+		return
+	}
+
+	_ = t.Send(TerminalMessage{Type: "exit", ExitCode: inspect.ExitCode})
+}
+
+// AttachTerminal attaches to the main process of a container over a WebSocket
+func (a *API) AttachTerminal(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	logs, err := queryBool(r, "logs", false)
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	c, err := a.client.InspectContainerWithOptions(docker.InspectContainerOptions{
+		ID:      id,
+		Context: ctx,
+	})
+	if err != nil {
+		writeError(w, err, kindContainer, id)
+		return
+	}
+
+	if !c.State.Running {
+		writeError(w, &docker.ContainerNotRunning{ID: id}, kindContainer, id)
+		return
+	}
+
+	tty := c.Config != nil && c.Config.Tty
+	stdin := c.Config != nil && c.Config.OpenStdin
+
+	t, err := newTerminal(w, r, stdin, func(height, width int) error {
+		return a.client.ResizeContainerTTY(id, height, width)
+	})
+	if err != nil {
+		a.logger.Error(err)
+		return
+	}
+	defer t.Close()
+
+	opts := docker.AttachToContainerOptions{
+		Container:    id,
+		OutputStream: t.Output(terminalStdout),
+		ErrorStream:  t.Output(terminalStderr),
+		RawTerminal:  tty,
+		Logs:         logs,
+		Stream:       true,
+		Stdin:        stdin,
+		Stdout:       true,
+		Stderr:       true,
+	}
+	if stdin {
+		opts.InputStream = t.Stdin()
+	}
+
+	cw, err := a.client.AttachToContainerNonBlocking(opts)
+	if err != nil {
+		_ = t.Send(TerminalMessage{Type: "error", Error: err.Error()})
+		return
+	}
+
+	if err = waitOrClose(t.Context(), cw); err != nil {
+		_ = t.Send(TerminalMessage{Type: "error", Error: err.Error()})
+		return
+	}
+
+	inspect, err := a.client.InspectContainer(id)
+	if err != nil {
+		_ = t.Send(TerminalMessage{Type: "error", Error: err.Error()})
+		return
+	}
+
+	if !inspect.State.Running {
+		_ = t.Send(TerminalMessage{Type: "exit", ExitCode: inspect.State.ExitCode})
+	}
+}
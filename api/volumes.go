@@ -2,24 +2,224 @@ package api
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	docker "github.com/fsouza/go-dockerclient"
+	"github.com/go-chi/chi/v5"
 )
 
-// GetVolumes returns the list of volumes
+// VolumeContainer is a container mounting a volume
+type VolumeContainer struct {
+	ID          string
+	Name        string
+	State       string
+	Destination string
+	RW          bool
+}
+
+// VolumeInfo is a volume along with the containers mounting it. Stopped
+// containers are listed too, as they keep the volume from being removed
+type VolumeInfo struct {
+	docker.Volume
+	Containers []VolumeContainer
+}
+
+// volumeContainers returns the containers mounting each volume, by volume name
+func (a *API) volumeContainers(ctx context.Context) (map[string][]VolumeContainer, error) {
+	containers, err := a.client.ListContainers(docker.ListContainersOptions{
+		All:     true,
+		Context: ctx,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	users := make(map[string][]VolumeContainer)
+	for _, c := range containers {
+		var name string
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+
+		for _, m := range c.Mounts {
+			if m.Type != "volume" || m.Name == "" {
+				continue
+			}
+
+			users[m.Name] = append(users[m.Name], VolumeContainer{
+				ID:          c.ID,
+				Name:        name,
+				State:       c.State,
+				Destination: m.Destination,
+				RW:          m.RW,
+			})
+		}
+	}
+
+	return users, nil
+}
+
+// volumeInfo adds the containers mounting a volume to it
+func volumeInfo(volume docker.Volume, users map[string][]VolumeContainer) VolumeInfo {
+	containers := users[volume.Name]
+	if containers == nil {
+		containers = []VolumeContainer{}
+	}
+
+	return VolumeInfo{Volume: volume, Containers: containers}
+}
+
+// GetVolumes returns the list of volumes with the containers mounting them.
+// The dangling, driver, label and name parameters filter them like docker does
 func (a *API) GetVolumes(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
 	volumes, err := a.client.ListVolumes(docker.ListVolumesOptions{
+		Filters: queryFilters(r, "dangling", "driver", "label", "name"),
+		Context: ctx,
+	})
+	if err != nil {
+		writeError(w, err, "", "")
+		return
+	}
+
+	users, err := a.volumeContainers(ctx)
+	if err != nil {
+		writeError(w, err, "", "")
+		return
+	}
+
+	infos := make([]VolumeInfo, 0, len(volumes))
+	for _, v := range volumes {
+		infos = append(infos, volumeInfo(v, users))
+	}
+
+	write(w, http.StatusOK, infos)
+}
+
+// CreateVolume creates a volume. The body takes the name, driver, driver
+// options and labels; the daemon picks a name when none is given
+func (a *API) CreateVolume(w http.ResponseWriter, r *http.Request) {
+	var c docker.CreateVolumeOptions
+
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	if err := a.policy.AdmitVolume(&c); err != nil {
+		writeError(w, err, kindVolume, c.Name)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	c.Context = ctx
+
+	volume, err := a.client.CreateVolume(c)
+	if err != nil {
+		writeError(w, err, kindVolume, c.Name)
+		return
+	}
+
+	write(w, http.StatusOK, volume)
+}
+
+// InspectVolume returns a volume with the containers mounting it
+func (a *API) InspectVolume(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	// go-dockerclient inspects volumes without a context
+	resp, err := a.daemonRequest(ctx, http.MethodGet, "/volumes/"+id, nil, nil)
+	if err != nil {
+		var e *docker.Error
+		if errors.As(err, &e) && e.Status == http.StatusNotFound {
+			err = docker.ErrNoSuchVolume
+		}
+
+		writeError(w, err, kindVolume, id)
+		return
+	}
+	defer resp.Body.Close()
+
+	var volume docker.Volume
+	if err = json.NewDecoder(resp.Body).Decode(&volume); err != nil {
+		writeError(w, err, kindVolume, id)
+		return
+	}
+
+	users, err := a.volumeContainers(ctx)
+	if err != nil {
+		writeError(w, err, kindVolume, id)
+		return
+	}
+
+	write(w, http.StatusOK, volumeInfo(volume, users))
+}
+
+// RemoveVolume removes a volume. force removes it even when its driver fails
+// to; volumes mounted by a container are never removed and the error names
+// the containers
+func (a *API) RemoveVolume(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	force, err := queryBool(r, "force", false)
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	err = a.client.RemoveVolumeWithOptions(docker.RemoveVolumeOptions{
+		Name:    id,
+		Force:   force,
+		Context: ctx,
+	})
+	if errors.Is(err, docker.ErrVolumeInUse) {
+		if users, uerr := a.volumeContainers(ctx); uerr == nil && len(users[id]) > 0 {
+			names := make([]string, 0, len(users[id]))
+			for _, c := range users[id] {
+				names = append(names, c.Name)
+			}
+
+			err = fmt.Errorf("%w: %s", err, strings.Join(names, ", "))
+		}
+	}
+	if err != nil {
+		writeError(w, err, kindVolume, id)
+		return
+	}
+
+	write(w, http.StatusOK, Response{Message: "Volume deleted"})
+}
+
+// PruneVolumes removes the volumes no container mounts. The label and label!
+// parameters filter them like docker does; all includes named volumes, which
+// recent daemons otherwise keep
+func (a *API) PruneVolumes(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	pruned, err := a.client.PruneVolumes(docker.PruneVolumesOptions{
+		Filters: queryFilters(r, "label", "label!", "all"),
 		Context: ctx,
 	})
 	if err != nil {
-		write(w, http.StatusInternalServerError, Response{Error: err.Error()})
+		writeError(w, err, "", "")
 		return
 	}
 
-	write(w, http.StatusOK, volumes)
+	write(w, http.StatusOK, pruned)
 }
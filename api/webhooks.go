@@ -0,0 +1,934 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/go-chi/chi/v5"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// webhookAttempts is the number of times a delivery is tried
+	webhookAttempts = 8
+
+	// webhookBackoff is the wait before the first retry, doubled after every attempt
+	webhookBackoff = 2 * time.Second
+
+	// maxWebhookBackoff caps the wait between two attempts
+	maxWebhookBackoff = 10 * time.Minute
+
+	// maxWebhookDeliveries is the number of deliveries kept per webhook
+	maxWebhookDeliveries = 500
+
+	// webhookWorkers is the number of deliveries attempted at the same time
+	webhookWorkers = 16
+
+	// webhookQueue is the number of events waiting to be dispatched before the
+	// hub subscription is dropped and the events are replayed later
+	webhookQueue = 4096
+)
+
+// Delivery states
+const (
+	deliveryPending   = "pending"
+	deliveryDelivered = "delivered"
+	deliveryFailed    = "failed"
+)
+
+var (
+	webhooksBucket   = []byte("webhooks")
+	deliveriesBucket = []byte("deliveries")
+	stateBucket      = []byte("state")
+
+	// lastEventKey holds the TimeNano of the last dispatched event
+	lastEventKey = []byte("lastEvent")
+)
+
+// Webhook is a target notified of the docker events that pass its filters.
+// The secret is only returned when the webhook is created
+type Webhook struct {
+	ID      string
+	URL     string
+	Secret  string              `json:",omitempty"`
+	Filters map[string][]string `json:",omitempty"`
+	Created time.Time
+}
+
+// WebhookRequest is the body of a webhook create request. A secret is
+// generated when none is given; filters are those of the events endpoint
+type WebhookRequest struct {
+	URL     string
+	Secret  string
+	Filters map[string][]string
+}
+
+// WebhookPayload is the JSON body posted to a webhook
+type WebhookPayload struct {
+	Webhook  string
+	Delivery string
+	Event    docker.APIEvents
+}
+
+// WebhookAttempt is a single attempt to deliver an event
+type WebhookAttempt struct {
+	Time       time.Time
+	StatusCode int     `json:",omitempty"`
+	Error      string  `json:",omitempty"`
+	Duration   float64 // seconds
+}
+
+// WebhookDelivery is the delivery of an event to a webhook
+type WebhookDelivery struct {
+	ID          string
+	Webhook     string
+	Event       docker.APIEvents
+	Status      string // pending, delivered or failed
+	Attempts    []WebhookAttempt
+	Created     time.Time
+	Redelivered string `json:",omitempty"` // ID of the delivery this one repeats
+}
+
+// Webhooks stores webhooks and their deliveries in a bbolt file and delivers
+// events to them. Deliveries are attempted by a fixed pool of workers; a
+// scheduler hands them out when they are due, so that waiting for a retry
+// holds no goroutine
+type Webhooks struct {
+	db        *bolt.DB
+	client    *http.Client
+	lastEvent atomic.Int64
+
+	schedule chan scheduledDelivery
+	jobs     chan *WebhookDelivery
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// scheduledDelivery is a delivery waiting for its next attempt
+type scheduledDelivery struct {
+	at time.Time
+	d  *WebhookDelivery
+}
+
+// OpenWebhooks opens or creates a webhook store at path and starts the
+// delivery workers
+func OpenWebhooks(path string) (*Webhooks, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	var lastEvent int64
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{webhooksBucket, deliveriesBucket, stateBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+
+		if v := tx.Bucket(stateBucket).Get(lastEventKey); len(v) == 8 {
+			lastEvent = int64(binary.BigEndian.Uint64(v))
+		}
+
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	wh := &Webhooks{
+		db: db,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+			// following a redirect would turn the signed POST into a GET elsewhere
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		schedule: make(chan scheduledDelivery, webhookWorkers),
+		jobs:     make(chan *WebhookDelivery),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	wh.lastEvent.Store(lastEvent)
+
+	wh.wg.Add(1 + webhookWorkers)
+	go wh.scheduler()
+	for range webhookWorkers {
+		go wh.worker()
+	}
+
+	return wh, nil
+}
+
+// Close stops the delivery workers and closes the store. Deliveries still
+// pending are resumed by the next Resume
+func (wh *Webhooks) Close() error {
+	wh.cancel()
+	wh.wg.Wait()
+
+	return wh.db.Close()
+}
+
+// errNoSuchWebhook returns the error reported for an unknown webhook
+func errNoSuchWebhook(id string) error {
+	return withStatus(http.StatusNotFound, errors.New("No such webhook: "+id))
+}
+
+// errNoSuchDelivery returns the error reported for an unknown delivery
+func errNoSuchDelivery(id string) error {
+	return withStatus(http.StatusNotFound, errors.New("No such delivery: "+id))
+}
+
+// Create stores a new webhook
+func (wh *Webhooks) Create(hook *Webhook) error {
+	data, err := json.Marshal(hook)
+	if err != nil {
+		return err
+	}
+
+	return wh.db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.Bucket(deliveriesBucket).CreateBucketIfNotExists([]byte(hook.ID)); err != nil {
+			return err
+		}
+
+		return tx.Bucket(webhooksBucket).Put([]byte(hook.ID), data)
+	})
+}
+
+// Get returns a webhook
+func (wh *Webhooks) Get(id string) (*Webhook, error) {
+	var hook Webhook
+
+	err := wh.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(webhooksBucket).Get([]byte(id))
+		if data == nil {
+			return errNoSuchWebhook(id)
+		}
+
+		return json.Unmarshal(data, &hook)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &hook, nil
+}
+
+// List returns every webhook, oldest first
+func (wh *Webhooks) List() ([]Webhook, error) {
+	hooks := []Webhook{}
+
+	err := wh.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(webhooksBucket).ForEach(func(_, v []byte) error {
+			var hook Webhook
+			if err := json.Unmarshal(v, &hook); err != nil {
+				return err
+			}
+
+			hooks = append(hooks, hook)
+			return nil
+		})
+	})
+
+	slices.SortFunc(hooks, func(x, y Webhook) int {
+		return x.Created.Compare(y.Created)
+	})
+
+	return hooks, err
+}
+
+// Delete removes a webhook along with its deliveries
+func (wh *Webhooks) Delete(id string) error {
+	return wh.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(webhooksBucket).Get([]byte(id)) == nil {
+			return errNoSuchWebhook(id)
+		}
+
+		if err := tx.Bucket(deliveriesBucket).DeleteBucket([]byte(id)); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+			return err
+		}
+
+		return tx.Bucket(webhooksBucket).Delete([]byte(id))
+	})
+}
+
+// PutDelivery stores a delivery, assigning it an ID when it has none
+func (wh *Webhooks) PutDelivery(d *WebhookDelivery) error {
+	return wh.db.Update(func(tx *bolt.Tx) error {
+		return putDelivery(tx, d)
+	})
+}
+
+// putDelivery stores a delivery in tx. Only the latest finished deliveries of
+// every webhook are kept; pending ones are never pruned, as their worker
+// would store them again
+func putDelivery(tx *bolt.Tx, d *WebhookDelivery) error {
+	b := tx.Bucket(deliveriesBucket).Bucket([]byte(d.Webhook))
+	if b == nil {
+		return errNoSuchWebhook(d.Webhook)
+	}
+
+	if d.ID == "" {
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		d.ID = strconv.FormatUint(seq, 10)
+	}
+
+	key, err := deliveryKey(d.ID)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+
+	if err = b.Put(key, data); err != nil {
+		return err
+	}
+
+	excess := b.Stats().KeyN - maxWebhookDeliveries
+	if excess <= 0 {
+		return nil
+	}
+
+	// collected first, deleting under a cursor skips keys
+	var prune [][]byte
+	c := b.Cursor()
+	for k, v := c.First(); k != nil && len(prune) < excess; k, v = c.Next() {
+		var old struct{ Status string }
+		if err = json.Unmarshal(v, &old); err != nil {
+			return err
+		}
+
+		if old.Status != deliveryPending {
+			prune = append(prune, k)
+		}
+	}
+
+	for _, k := range prune {
+		if err = b.Delete(k); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deliveryKey returns the key of a delivery, which keeps them in creation order
+func deliveryKey(id string) ([]byte, error) {
+	seq, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, errNoSuchDelivery(id)
+	}
+
+	return binary.BigEndian.AppendUint64(nil, seq), nil
+}
+
+// GetDelivery returns a delivery of a webhook
+func (wh *Webhooks) GetDelivery(hookID, id string) (*WebhookDelivery, error) {
+	key, err := deliveryKey(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var d WebhookDelivery
+
+	err = wh.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(deliveriesBucket).Bucket([]byte(hookID))
+		if b == nil {
+			return errNoSuchWebhook(hookID)
+		}
+
+		data := b.Get(key)
+		if data == nil {
+			return errNoSuchDelivery(id)
+		}
+
+		return json.Unmarshal(data, &d)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &d, nil
+}
+
+// Deliveries returns the deliveries of a webhook, oldest first. An empty
+// hookID returns the deliveries of every webhook
+func (wh *Webhooks) Deliveries(hookID string) ([]WebhookDelivery, error) {
+	deliveries := []WebhookDelivery{}
+
+	err := wh.db.View(func(tx *bolt.Tx) error {
+		collect := func(b *bolt.Bucket) error {
+			return b.ForEach(func(_, v []byte) error {
+				var d WebhookDelivery
+				if err := json.Unmarshal(v, &d); err != nil {
+					return err
+				}
+
+				deliveries = append(deliveries, d)
+				return nil
+			})
+		}
+
+		if hookID == "" {
+			return tx.Bucket(deliveriesBucket).ForEachBucket(func(k []byte) error {
+				return collect(tx.Bucket(deliveriesBucket).Bucket(k))
+			})
+		}
+
+		b := tx.Bucket(deliveriesBucket).Bucket([]byte(hookID))
+		if b == nil {
+			return errNoSuchWebhook(hookID)
+		}
+
+		return collect(b)
+	})
+
+	return deliveries, err
+}
+
+// LastEvent returns the time of the last dispatched event, zero when none was
+func (wh *Webhooks) LastEvent() time.Time {
+	if n := wh.lastEvent.Load(); n > 0 {
+		return time.Unix(0, n)
+	}
+
+	return time.Time{}
+}
+
+// Dispatch creates a delivery of every event for each webhook whose filters
+// it passes and schedules them. Events not newer than the last dispatched one
+// were dispatched already and are skipped. The deliveries and the time of the
+// last event are stored in one transaction; when no webhook matches nothing
+// is written, and the time is stored along with the next deliveries
+func (wh *Webhooks) Dispatch(events ...*docker.APIEvents) error {
+	last := wh.lastEvent.Load()
+	events = slices.DeleteFunc(slices.Clone(events), func(ev *docker.APIEvents) bool {
+		return ev.TimeNano != 0 && ev.TimeNano <= last
+	})
+	if len(events) == 0 {
+		return nil
+	}
+
+	hooks, err := wh.List()
+	if err != nil {
+		return err
+	}
+
+	var deliveries []*WebhookDelivery
+	for _, ev := range events {
+		for _, hook := range hooks {
+			if eventFilter(hook.Filters).Match(ev) {
+				deliveries = append(deliveries, &WebhookDelivery{Webhook: hook.ID, Event: *ev, Status: deliveryPending, Created: time.Now()})
+			}
+		}
+
+		last = max(last, ev.TimeNano)
+	}
+
+	if len(deliveries) > 0 {
+		err = wh.db.Update(func(tx *bolt.Tx) error {
+			for _, d := range deliveries {
+				// webhooks deleted meanwhile get no deliveries
+				if tx.Bucket(deliveriesBucket).Bucket([]byte(d.Webhook)) == nil {
+					continue
+				}
+
+				if err := putDelivery(tx, d); err != nil {
+					return err
+				}
+			}
+
+			return tx.Bucket(stateBucket).Put(lastEventKey, binary.BigEndian.AppendUint64(nil, uint64(last)))
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	wh.lastEvent.Store(last)
+
+	for _, d := range deliveries {
+		if d.ID != "" {
+			wh.enqueue(d, time.Now())
+		}
+	}
+
+	return nil
+}
+
+// Redeliver sends the event of a delivery again as a new delivery
+func (wh *Webhooks) Redeliver(hookID, id string) (*WebhookDelivery, error) {
+	orig, err := wh.GetDelivery(hookID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &WebhookDelivery{
+		Webhook:     hookID,
+		Event:       orig.Event,
+		Status:      deliveryPending,
+		Created:     time.Now(),
+		Redelivered: orig.ID,
+	}
+	if err = wh.PutDelivery(d); err != nil {
+		return nil, err
+	}
+
+	// the worker owns the scheduled copy, the caller gets a snapshot
+	snapshot := *d
+	wh.enqueue(d, time.Now())
+
+	return &snapshot, nil
+}
+
+// Resume schedules the deliveries left pending by a previous run
+func (wh *Webhooks) Resume() error {
+	deliveries, err := wh.Deliveries("")
+	if err != nil {
+		return err
+	}
+
+	for i := range deliveries {
+		if deliveries[i].Status == deliveryPending {
+			wh.enqueue(&deliveries[i], time.Now())
+		}
+	}
+
+	return nil
+}
+
+// enqueue hands a delivery to the scheduler for an attempt at the given time
+func (wh *Webhooks) enqueue(d *WebhookDelivery, at time.Time) {
+	select {
+	case wh.schedule <- scheduledDelivery{at: at, d: d}:
+	case <-wh.ctx.Done():
+	}
+}
+
+// scheduler keeps the deliveries waiting for an attempt ordered by time and
+// passes each one to a worker once it is due
+func (wh *Webhooks) scheduler() {
+	defer wh.wg.Done()
+
+	var queue []scheduledDelivery
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		var jobs chan *WebhookDelivery
+		var next *WebhookDelivery
+
+		if len(queue) > 0 {
+			if wait := time.Until(queue[0].at); wait > 0 {
+				timer.Reset(wait)
+			} else {
+				jobs, next = wh.jobs, queue[0].d
+			}
+		}
+
+		select {
+		case <-wh.ctx.Done():
+			return
+		case s := <-wh.schedule:
+			i, _ := slices.BinarySearchFunc(queue, s.at, func(e scheduledDelivery, t time.Time) int {
+				return e.at.Compare(t)
+			})
+			// after deliveries due at the same time, so that they keep their order
+			for i < len(queue) && !queue[i].at.After(s.at) {
+				i++
+			}
+			queue = slices.Insert(queue, i, s)
+		case jobs <- next:
+			queue = queue[1:]
+		case <-timer.C:
+		}
+	}
+}
+
+// worker attempts the deliveries handed out by the scheduler
+func (wh *Webhooks) worker() {
+	defer wh.wg.Done()
+
+	for {
+		select {
+		case <-wh.ctx.Done():
+			return
+		case d := <-wh.jobs:
+			wh.deliver(d)
+		}
+	}
+}
+
+// deliver attempts a delivery once and stores the outcome. Failures worth a
+// retry are scheduled again, waiting twice as long after every attempt, until
+// the attempts run out. The webhook is read again before every attempt, so a
+// deleted webhook stops its retries
+func (wh *Webhooks) deliver(d *WebhookDelivery) {
+	hook, err := wh.Get(d.Webhook)
+	if err != nil {
+		return
+	}
+
+	attempt, retry := wh.attempt(hook, d)
+	if wh.ctx.Err() != nil {
+		// interrupted by Close, resumed on the next start
+		return
+	}
+
+	d.Attempts = append(d.Attempts, attempt)
+
+	switch {
+	case attempt.Error == "":
+		d.Status = deliveryDelivered
+	case !retry || len(d.Attempts) >= webhookAttempts:
+		d.Status = deliveryFailed
+	}
+
+	if err = wh.PutDelivery(d); err != nil || d.Status != deliveryPending {
+		return
+	}
+
+	backoff := min(webhookBackoff<<(len(d.Attempts)-1), maxWebhookBackoff)
+	wh.enqueue(d, time.Now().Add(backoff))
+}
+
+// attempt posts a delivery once, reporting whether a failure is worth a retry
+func (wh *Webhooks) attempt(hook *Webhook, d *WebhookDelivery) (WebhookAttempt, bool) {
+	attempt := WebhookAttempt{Time: time.Now()}
+	defer func() {
+		attempt.Duration = time.Since(attempt.Time).Seconds()
+	}()
+
+	body, err := json.Marshal(WebhookPayload{Webhook: hook.ID, Delivery: d.ID, Event: d.Event})
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt, false
+	}
+
+	req, err := http.NewRequestWithContext(wh.ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt, false
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "docker-api-webhooks")
+	req.Header.Set("X-Webhook-ID", hook.ID)
+	req.Header.Set("X-Webhook-Delivery", d.ID)
+	req.Header.Set("X-Webhook-Event", d.Event.Type+"."+d.Event.Action)
+	req.Header.Set("X-Webhook-Signature", signPayload(hook.Secret, body))
+
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt, true
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	attempt.StatusCode = resp.StatusCode
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return attempt, false
+	}
+
+	attempt.Error = resp.Status
+
+	// redirects are not followed, other client errors will not go away by trying again
+	retry := resp.StatusCode >= 500 ||
+		resp.StatusCode == http.StatusRequestTimeout ||
+		resp.StatusCode == http.StatusTooManyRequests
+
+	return attempt, retry
+}
+
+// signPayload returns the X-Webhook-Signature of a payload: the hex encoded
+// HMAC-SHA256 of the body keyed with the webhook secret
+func signPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// randomID returns n random bytes hex encoded
+func randomID(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// SetWebhooks starts delivering docker events to the webhooks of store,
+// resuming the deliveries a previous run left pending
+func (a *API) SetWebhooks(store *Webhooks) {
+	a.webhooks = store
+
+	if err := store.Resume(); err != nil {
+		a.logger.Error("Webhook deliveries not resumed: ", err)
+	}
+
+	go a.dispatchWebhooks(store)
+}
+
+// dispatchWebhooks follows the event hub and dispatches the events to
+// store. Events are queued to a separate dispatcher, so that writing the
+// deliveries does not hold up the subscription
+func (a *API) dispatchWebhooks(store *Webhooks) {
+	queue := make(chan *docker.APIEvents, webhookQueue)
+
+	go func() {
+		for ev := range queue {
+			if err := store.Dispatch(drainEvents(ev, queue, eventBuffer)...); err != nil {
+				a.logger.Error("Webhook dispatch failed: ", err)
+			}
+		}
+	}()
+
+	since := func() (time.Time, error) {
+		return store.LastEvent(), nil
+	}
+
+	a.followEvents("Webhook", since, func(events []*docker.APIEvents) {
+		// blocks while the dispatcher is behind; should the hub drop the
+		// subscription meanwhile, the missed events are replayed
+		for _, ev := range events {
+			queue <- ev
+		}
+	})
+}
+
+// webhooksEnabled reports a request made while webhooks are not configured
+func (a *API) webhooksEnabled(w http.ResponseWriter) bool {
+	if a.webhooks == nil {
+		write(w, http.StatusNotImplemented, Response{Error: "Webhooks are not enabled"})
+		return false
+	}
+
+	return true
+}
+
+// CreateWebhook registers a webhook. The secret used to sign the payloads is
+// only returned here
+func (a *API) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	if !a.webhooksEnabled(w) {
+		return
+	}
+
+	var c WebhookRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	u, err := url.Parse(c.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		write(w, http.StatusBadRequest, Response{Error: "URL must be an absolute http or https URL"})
+		return
+	}
+
+	filters := make(map[string][]string)
+	for key, values := range c.Filters {
+		if !slices.Contains(eventFilterKeys, key) {
+			write(w, http.StatusBadRequest, Response{Error: "invalid filter: " + strconv.Quote(key)})
+			return
+		}
+
+		if key == "action" {
+			key = "event"
+		}
+		filters[key] = append(filters[key], values...)
+	}
+
+	hook := &Webhook{URL: c.URL, Secret: c.Secret, Filters: filters, Created: time.Now()}
+
+	if hook.ID, err = randomID(16); err != nil {
+		writeError(w, err, "", "")
+		return
+	}
+
+	if hook.Secret == "" {
+		if hook.Secret, err = randomID(32); err != nil {
+			writeError(w, err, "", "")
+			return
+		}
+	}
+
+	if err = a.webhooks.Create(hook); err != nil {
+		writeError(w, err, kindWebhook, hook.ID)
+		return
+	}
+
+	write(w, http.StatusOK, hook)
+}
+
+// ListWebhooks returns the registered webhooks
+func (a *API) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	if !a.webhooksEnabled(w) {
+		return
+	}
+
+	hooks, err := a.webhooks.List()
+	if err != nil {
+		writeError(w, err, "", "")
+		return
+	}
+
+	for i := range hooks {
+		hooks[i].Secret = ""
+	}
+
+	write(w, http.StatusOK, hooks)
+}
+
+// GetWebhook returns a webhook
+func (a *API) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	if !a.webhooksEnabled(w) {
+		return
+	}
+
+	hook, err := a.webhooks.Get(id)
+	if err != nil {
+		writeError(w, err, kindWebhook, id)
+		return
+	}
+
+	hook.Secret = ""
+
+	write(w, http.StatusOK, hook)
+}
+
+// DeleteWebhook removes a webhook and its delivery history
+func (a *API) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	if !a.webhooksEnabled(w) {
+		return
+	}
+
+	if err := a.webhooks.Delete(id); err != nil {
+		writeError(w, err, kindWebhook, id)
+		return
+	}
+
+	write(w, http.StatusOK, Response{Message: "Webhook deleted"})
+}
+
+// WebhookDeliveries returns the delivery history of a webhook, newest first
+// unless order=asc, optionally limited to a status and paginated with limit
+// and offset
+func (a *API) WebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	if !a.webhooksEnabled(w) {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", deliveryPending, deliveryDelivered, deliveryFailed:
+	default:
+		write(w, http.StatusBadRequest, Response{Error: "invalid status parameter: " + strconv.Quote(status)})
+		return
+	}
+
+	_, desc, err := querySort(r, "created")
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	deliveries, err := a.webhooks.Deliveries(id)
+	if err != nil {
+		writeError(w, err, kindWebhook, id)
+		return
+	}
+
+	if status != "" {
+		deliveries = slices.DeleteFunc(deliveries, func(d WebhookDelivery) bool {
+			return d.Status != status
+		})
+	}
+
+	if desc {
+		slices.Reverse(deliveries)
+	}
+
+	deliveries, err = paginate(w, r, deliveries)
+	if err != nil {
+		write(w, http.StatusBadRequest, Response{Error: err.Error()})
+		return
+	}
+
+	write(w, http.StatusOK, deliveries)
+}
+
+// WebhookDelivery returns a single delivery of a webhook
+func (a *API) WebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	delivery := chi.URLParam(r, "delivery")
+
+	if !a.webhooksEnabled(w) {
+		return
+	}
+
+	d, err := a.webhooks.GetDelivery(id, delivery)
+	if err != nil {
+		writeError(w, err, kindWebhook, id)
+		return
+	}
+
+	write(w, http.StatusOK, d)
+}
+
+// RedeliverWebhook sends the event of a past delivery again. The new
+// delivery is returned right away and can be followed in the history
+func (a *API) RedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	delivery := chi.URLParam(r, "delivery")
+
+	if !a.webhooksEnabled(w) {
+		return
+	}
+
+	d, err := a.webhooks.Redeliver(id, delivery)
+	if err != nil {
+		writeError(w, err, kindWebhook, id)
+		return
+	}
+
+	write(w, http.StatusAccepted, d)
+}
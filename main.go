@@ -3,7 +3,10 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"os"
 	"runtime"
+	"strconv"
+	"time"
 
 	"github.com/sirupsen/logrus"
 
@@ -32,6 +35,52 @@ func main() {
 		log.Fatal(err)
 	}
 
+	if name := os.Getenv("DOCKER_API_POLICY"); name != "" {
+		policy, err := api.LoadPolicy(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		a.SetPolicy(policy)
+		log.Info("Admission policy loaded from ", name)
+	}
+
+	if name := os.Getenv("DOCKER_API_EVENTS_DB"); name != "" {
+		retention := api.EventRetention{MaxAge: 7 * 24 * time.Hour}
+
+		if v := os.Getenv("DOCKER_API_EVENTS_MAX_AGE"); v != "" {
+			if retention.MaxAge, err = time.ParseDuration(v); err != nil {
+				log.Fatal("DOCKER_API_EVENTS_MAX_AGE: ", err)
+			}
+		}
+
+		if v := os.Getenv("DOCKER_API_EVENTS_MAX"); v != "" {
+			if retention.MaxEvents, err = strconv.Atoi(v); err != nil {
+				log.Fatal("DOCKER_API_EVENTS_MAX: ", err)
+			}
+		}
+
+		store, err := api.OpenEventStore(name, retention)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer store.Close()
+
+		a.SetEventStore(store)
+		log.Info("Recording docker events to ", name)
+	}
+
+	if name := os.Getenv("DOCKER_API_WEBHOOKS_DB"); name != "" {
+		webhooks, err := api.OpenWebhooks(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer webhooks.Close()
+
+		a.SetWebhooks(webhooks)
+		log.Info("Webhooks stored in ", name)
+	}
+
 	r.Route("/api/docker", a.Router())
 
 	log.Trace("Starting server on http://localhost:8080/api/docker")